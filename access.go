@@ -0,0 +1,51 @@
+package main
+
+// locateImage is like [GameState.locatePhoto], but also accepts the keys of derivatives.
+func (gs *GameState) locateImage(key string) (PhotoLocation, bool) {
+	if original, _, ok := parseDerivativeKey(key); ok {
+		key = original
+	}
+	return gs.locatePhoto(key)
+}
+
+// imageOwner returns the player whose board references the given image or one of its derivatives.
+func (gs *GameState) imageOwner(key string) (PlayerName, bool) {
+	loc, ok := gs.locateImage(key)
+	return loc.Player, ok
+}
+
+// imageAccess reports whether the viewer (nil if not signed in) may see the given image,
+// and whether it may be seen by everyone.
+func (gs *GameState) imageAccess(viewer *PlayerName, key string) (allowed bool, public bool) {
+	loc, referenced := gs.locateImage(key)
+	if !referenced {
+		// discarded images are only kept around in case a moderator needs to restore them
+		return viewer != nil && gs.Players[*viewer].Moderator, false
+	}
+	owner := loc.Player
+	if loc.Photo.Hidden {
+		return viewer != nil && (*viewer == owner || gs.Players[*viewer].Moderator), false
+	}
+	if gs.Settings.GalleryPublished {
+		return true, true
+	}
+	if viewer == nil {
+		return false, false
+	}
+	vs := gs.Players[*viewer]
+	if *viewer == owner || vs.Moderator {
+		return true, false
+	}
+	if gs.Settings.Phase != PhasePlaying || gs.Settings.verifiers() == VerifyPeers {
+		// players need to see each other's photos to vote on or verify them
+		return true, false
+	}
+	switch gs.Settings.ImageVisibility {
+	case VisibilityPlayers:
+		return true, false
+	case VisibilityTeam:
+		return vs.Team != "" && vs.Team == gs.Players[owner].Team, false
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The JSON API for native apps and bots, described in openapi.yaml.
+// Compatible changes, like new fields, don't need a new version.
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// APIError is the body of every failed API request.
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+type APIErrorDetail struct {
+	Code    string `json:"code"` // derived from the HTTP status, see [apiErrorCode]
+	Message string `json:"message"`
+}
+
+type APIGame struct {
+	Phase             string     `json:"phase"`
+	Completion        string     `json:"completion"`
+	Verification      string     `json:"verification"`
+	RequiredApprovals int        `json:"requiredApprovals,omitempty"`
+	ImageVisibility   string     `json:"imageVisibility"`
+	GalleryPublished  bool       `json:"galleryPublished"`
+	CommentsDisabled  bool       `json:"commentsDisabled"`
+	ReactionsDisabled bool       `json:"reactionsDisabled"`
+	Start             *time.Time `json:"start,omitempty"`
+	End               *time.Time `json:"end,omitempty"`
+	Players           int        `json:"players"`
+}
+
+type APIBoard struct {
+	Player PlayerName `json:"player"`
+	Score  int        `json:"score"`
+	Spaces []APISpace `json:"spaces"` // row by row
+}
+
+type APISpace struct {
+	X         int          `json:"x"`
+	Y         int          `json:"y"`
+	Goal      APIGoal      `json:"goal"`
+	Completed bool         `json:"completed"`
+	Locked    bool         `json:"locked"`
+	Review    ReviewStatus `json:"review,omitempty"`
+	Rejection string       `json:"rejection,omitempty"`
+	Hero      *APIPhoto    `json:"hero,omitempty"`
+	Photos    []APIPhoto   `json:"photos,omitempty"` // all of them including the hero, only in the details of a space
+}
+
+type APIGoal struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type APIPhoto struct {
+	Key          string    `json:"key"`
+	Caption      string    `json:"caption,omitempty"`
+	Uploaded     time.Time `json:"uploaded"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailUrl"`
+}
+
+type APILeaderboard struct {
+	Phase   string              `json:"phase"`
+	Rows    []APILeaderboardRow `json:"rows"`
+	Overall []PlayerName        `json:"overall,omitempty"` // most votes overall, once the game has ended
+}
+
+type APILeaderboardRow struct {
+	Rank      int        `json:"rank"`
+	Player    PlayerName `json:"player"`
+	Score     int        `json:"score"`
+	Completed int        `json:"completed"`
+	GoalsWon  int        `json:"goalsWon,omitempty"`
+	Votes     int        `json:"votes,omitempty"`
+}
+
+// registerAPI adds the API endpoints below /[apiPath]/.
+func registerAPI(mux *http.ServeMux) {
+	prefix := "/" + apiPath
+
+	mux.HandleFunc("GET "+prefix+"/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPISpec)
+	})
+
+	handleAPI(mux, "GET "+prefix+"/game", func(w http.ResponseWriter, r *http.Request, user PlayerName) error {
+		gs := gameState.Snapshot()
+		settings := gs.Settings
+		res := APIGame{
+			Phase:             cmp.Or(string(settings.Phase), "playing"),
+			Completion:        cmp.Or(string(settings.Completion), "honor"),
+			Verification:      cmp.Or(string(settings.verifiers()), "none"),
+			ImageVisibility:   cmp.Or(string(settings.ImageVisibility), "owner"),
+			GalleryPublished:  settings.GalleryPublished,
+			CommentsDisabled:  settings.CommentsDisabled,
+			ReactionsDisabled: settings.ReactionsDisabled,
+			Players:           len(gs.Players),
+		}
+		if settings.verifiers() == VerifyPeers {
+			res.RequiredApprovals = settings.RequiredApprovals
+		}
+		if !settings.Start.IsZero() {
+			res.Start = &settings.Start
+		}
+		if !settings.End.IsZero() {
+			res.End = &settings.End
+		}
+		return writeJSON(w, http.StatusOK, res)
+	})
+
+	handleAPI(mux, "GET "+prefix+"/board", func(w http.ResponseWriter, r *http.Request, user PlayerName) error {
+		gs := gameState.Snapshot()
+		ps := gs.Players[user]
+		res := APIBoard{
+			Player: user,
+			Score:  ps.Board.score(gs.Settings),
+		}
+		for y := range 5 {
+			for x := range 5 {
+				res.Spaces = append(res.Spaces, gs.apiSpace(user, x, y, false))
+			}
+		}
+		return writeJSON(w, http.StatusOK, res)
+	})
+
+	handleAPI(mux, "GET "+prefix+"/spaces/{x}/{y}", func(w http.ResponseWriter, r *http.Request, user PlayerName) error {
+		x, y, err := parseSpace(r)
+		if err != nil {
+			return err
+		}
+		gs := gameState.Snapshot()
+		return writeJSON(w, http.StatusOK, gs.apiSpace(user, x, y, true))
+	})
+
+	for _, action := range []string{"complete", "decomplete"} {
+		handleAPI(mux, "POST "+prefix+"/spaces/{x}/{y}/"+action, func(w http.ResponseWriter, r *http.Request, user PlayerName) error {
+			x, y, err := parseSpace(r)
+			if err != nil {
+				return err
+			}
+			if err := performSpaceAction(user, x, y, SpaceAction{Action: action}); err != nil {
+				return err
+			}
+			gs := gameState.Snapshot()
+			return writeJSON(w, http.StatusOK, gs.apiSpace(user, x, y, true))
+		})
+	}
+
+	handleAPI(mux, "POST "+prefix+"/spaces/{x}/{y}/photos", func(w http.ResponseWriter, r *http.Request, user PlayerName) error {
+		x, y, err := parseSpace(r)
+		if err != nil {
+			return err
+		}
+		srcData, err := readUpload(w, r)
+		if err != nil {
+			return err
+		}
+		upload, err := storeUpload(r.Context(), user, x, y, srcData, r.FormValue("caption"))
+		if err != nil {
+			return err
+		}
+		if err := performSpaceAction(user, x, y, SpaceAction{Action: "upload", Upload: upload}); err != nil {
+			return err
+		}
+		gs := gameState.Snapshot()
+		return writeJSON(w, http.StatusCreated, gs.apiSpace(user, x, y, true))
+	})
+
+	handleAPI(mux, "GET "+prefix+"/leaderboard", func(w http.ResponseWriter, r *http.Request, user PlayerName) error {
+		gs := gameState.Snapshot()
+		lb := gs.leaderboard(user)
+		res := APILeaderboard{
+			Phase:   cmp.Or(string(lb.Phase), "playing"),
+			Rows:    make([]APILeaderboardRow, 0, len(lb.Rows)),
+			Overall: lb.Overall,
+		}
+		for _, row := range lb.Rows {
+			res.Rows = append(res.Rows, APILeaderboardRow(row))
+		}
+		return writeJSON(w, http.StatusOK, res)
+	})
+
+	// otherwise unknown API paths would end up at the HTML pages
+	catchAll := prefix + "/"
+	mux.HandleFunc(catchAll, func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
+		if allowed := allowedMethods(mux, r, catchAll); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			serveAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s %s is not supported, use %s", r.Method, r.URL.Path, strings.Join(allowed, " or ")))
+			return
+		}
+		serveAPIError(w, http.StatusNotFound, fmt.Errorf("no endpoint %s %s", r.Method, r.URL.Path))
+	})
+}
+
+// allowedMethods returns the methods that an endpoint other than the catch-all pattern serves the request's path with.
+func allowedMethods(mux *http.ServeMux, r *http.Request, catchAll string) []string {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != catchAll {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// handleAPI registers an endpoint for signed up players.
+// Errors are served as [APIError], with the status of a [statusError] or 400 Bad Request.
+func handleAPI(mux *http.ServeMux, pattern string, handler func(w http.ResponseWriter, r *http.Request, user PlayerName) error) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
+		user, err := checkAuth(r)
+		if err != nil || user == nil {
+			serveAPIError(w, http.StatusUnauthorized, errors.Join(errors.New("not signed in"), err))
+			return
+		}
+		if err := handler(w, r, *user); err != nil {
+			serveAPIError(w, errorStatus(err, http.StatusBadRequest), err)
+		}
+	})
+}
+
+// apiSpace returns the user's space, including all its photos if details are requested.
+func (gs *GameState) apiSpace(user PlayerName, x, y int, details bool) APISpace {
+	ps := gs.Players[user]
+	space := ps.Board.get(x, y)
+	ds := space.display()
+	res := APISpace{
+		X:         x,
+		Y:         y,
+		Goal:      APIGoal(ds.Goal),
+		Completed: ds.Completed,
+		Locked:    gs.spaceLock(space) != nil,
+	}
+	if gs.Settings.verifiers() != VerifyNone && ds.Completed {
+		res.Review, res.Rejection = ds.Review, ds.Rejection
+	}
+	if ds.Hero != nil {
+		hero := apiPhoto(*ds.Hero)
+		res.Hero = &hero
+	}
+	if details {
+		for _, photo := range space.Photos {
+			res.Photos = append(res.Photos, apiPhoto(photo.display()))
+		}
+	}
+	return res
+}
+
+func apiPhoto(photo DisplayPhoto) APIPhoto {
+	return APIPhoto{
+		Key:          photo.Key,
+		Caption:      photo.Caption,
+		Uploaded:     photo.Uploaded,
+		URL:          basePath + "/" + photo.Image,
+		ThumbnailURL: basePath + "/" + photo.Thumbnail,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return statusError{http.StatusInternalServerError, err}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+	return nil
+}
+
+func serveAPIError(w http.ResponseWriter, statusCode int, err error) {
+	data, _ := json.Marshal(APIError{Error: APIErrorDetail{Code: apiErrorCode(statusCode), Message: err.Error()}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+// apiErrorCode returns the machine readable code of an error, as listed in openapi.yaml.
+func apiErrorCode(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusRequestEntityTooLarge:
+		return "too_large"
+	default:
+		return "internal"
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testAPI serves the API for the [testGameState] with honor completion.
+func testAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	gs := testGameState()
+	gs.Settings.Completion, gs.Settings.Verification = CompleteHonor, VerifyNone
+	alice := gs.Players["alice"]
+	alice.Board.get(2, 2).Completed = true // like on generated boards
+	gs.Players["alice"] = alice
+	gameState.Modify(func(GameState) GameState { return gs })
+	t.Cleanup(func() { gameState.Modify(func(GameState) GameState { return GameState{} }) })
+	store, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevBlobs := blobs
+	blobs = store
+	t.Cleanup(func() { blobs = prevBlobs })
+
+	mux := http.NewServeMux()
+	registerAPI(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// apiRequest sends a request as the user, or signed out if the user is empty, and decodes the JSON response into res.
+func apiRequest(t *testing.T, srv *httptest.Server, user PlayerName, method, path, contentType string, body io.Reader, res any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+"/"+apiPath+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if user != "" {
+		req.AddCookie(testAuthCookie(t, user))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("%s %s: Content-Type = %q, want application/json", method, path, got)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		t.Fatalf("%s %s: decoding response: %s", method, path, err)
+	}
+	return resp
+}
+
+// testAuthCookie returns the session cookie of a player in the [gameState].
+func testAuthCookie(t *testing.T, user PlayerName) *http.Cookie {
+	t.Helper()
+	var password InsecurePlaintextPassword
+	gameState.Read(func(gs GameState) { password = gs.Players[user].Password })
+	token, err := json.Marshal(InsecurePlaintextAuthToken{User: user, Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: authCookie, Value: authEncoding.EncodeToString(token)}
+}
+
+// checkAPIError checks that the request failed with the status and the error code listed in openapi.yaml.
+func checkAPIError(t *testing.T, srv *httptest.Server, user PlayerName, method, path string, statusCode int, code string) APIError {
+	t.Helper()
+	var res APIError
+	resp := apiRequest(t, srv, user, method, path, "", nil, &res)
+	if resp.StatusCode != statusCode || res.Error.Code != code || res.Error.Message == "" {
+		t.Errorf("%s %s = %d %+v, want %d with code %s and a message", method, path, resp.StatusCode, res, statusCode, code)
+	}
+	if !strings.Contains(string(openAPISpec), code) {
+		t.Errorf("error code %s is missing in openapi.yaml", code)
+	}
+	return res
+}
+
+func TestAPIRequiresSignIn(t *testing.T) {
+	srv := testAPI(t)
+	for _, path := range []string{"/game", "/board", "/spaces/0/0", "/leaderboard"} {
+		checkAPIError(t, srv, "", http.MethodGet, path, http.StatusUnauthorized, "unauthorized")
+	}
+	checkAPIError(t, srv, "", http.MethodPost, "/spaces/0/0/complete", http.StatusUnauthorized, "unauthorized")
+}
+
+func TestAPIUnknownEndpoints(t *testing.T) {
+	srv := testAPI(t)
+	checkAPIError(t, srv, "alice", http.MethodGet, "/nothing", http.StatusNotFound, "not_found")
+	for _, path := range []string{"/spaces/0/0/complete", "/spaces/0/0/decomplete", "/spaces/0/0/photos"} {
+		var res APIError
+		resp := apiRequest(t, srv, "alice", http.MethodGet, path, "", nil, &res)
+		if resp.StatusCode != http.StatusMethodNotAllowed || res.Error.Code != "method_not_allowed" {
+			t.Errorf("GET %s = %d %+v, want 405 method_not_allowed", path, resp.StatusCode, res)
+		}
+		if got := resp.Header.Get("Allow"); got != http.MethodPost {
+			t.Errorf("GET %s: Allow = %q, want POST", path, got)
+		}
+	}
+	checkAPIError(t, srv, "alice", http.MethodPost, "/leaderboard", http.StatusMethodNotAllowed, "method_not_allowed")
+}
+
+func TestAPICompleteAndDecomplete(t *testing.T) {
+	srv := testAPI(t)
+	var space APISpace
+	if resp := apiRequest(t, srv, "alice", http.MethodPost, "/spaces/0/1/complete", "", nil, &space); resp.StatusCode != http.StatusOK {
+		t.Fatalf("complete = %d", resp.StatusCode)
+	}
+	if space.X != 0 || space.Y != 1 || !space.Completed || space.Locked {
+		t.Errorf("completed space = %+v", space)
+	}
+	space = APISpace{}
+	if resp := apiRequest(t, srv, "alice", http.MethodPost, "/spaces/1/2/decomplete", "", nil, &space); resp.StatusCode != http.StatusOK {
+		t.Fatalf("decomplete = %d", resp.StatusCode)
+	}
+	if space.Completed || len(space.Photos) != 2 {
+		t.Errorf("decompleted space = %+v, want it to keep its photos", space)
+	}
+
+	var board APIBoard
+	apiRequest(t, srv, "alice", http.MethodGet, "/board", "", nil, &board)
+	if len(board.Spaces) != 25 {
+		t.Fatalf("board has %d spaces", len(board.Spaces))
+	}
+	for _, s := range board.Spaces {
+		wantCompleted := s.X == 0 && s.Y == 1 || s.X == 2 && s.Y == 2
+		if s.Completed != wantCompleted || s.Locked != (s.X == 2 && s.Y == 2) {
+			t.Errorf("space %d,%d: completed %t, locked %t", s.X, s.Y, s.Completed, s.Locked)
+		}
+	}
+}
+
+func TestAPIRejectsLockedSpaces(t *testing.T) {
+	srv := testAPI(t)
+	res := checkAPIError(t, srv, "alice", http.MethodPost, "/spaces/2/2/decomplete", http.StatusBadRequest, "bad_request")
+	if !strings.Contains(res.Error.Message, "free space") {
+		t.Errorf("decompleting the free space: %q", res.Error.Message)
+	}
+
+	gameState.Modify(func(gs GameState) GameState {
+		gs.Settings.Phase = PhaseEnded
+		return gs
+	})
+	res = checkAPIError(t, srv, "alice", http.MethodPost, "/spaces/0/0/complete", http.StatusBadRequest, "bad_request")
+	if !strings.Contains(res.Error.Message, "game is over") {
+		t.Errorf("completing a space after the game: %q", res.Error.Message)
+	}
+	var space APISpace
+	apiRequest(t, srv, "alice", http.MethodGet, "/spaces/0/0", "", nil, &space)
+	if space.Completed || !space.Locked {
+		t.Errorf("space after the game = %+v, want it locked and not completed", space)
+	}
+}
+
+func uploadBody(t *testing.T, image []byte) (string, io.Reader) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("image_file", "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(image)
+	mw.WriteField("caption", "from the API")
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), &body
+}
+
+func TestAPIUpload(t *testing.T) {
+	srv := testAPI(t)
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for x := range 64 {
+		img.Set(x, x%48, color.RGBA{R: uint8(x * 4), A: 255})
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	contentType, body := uploadBody(t, encoded.Bytes())
+	var space APISpace
+	if resp := apiRequest(t, srv, "alice", http.MethodPost, "/spaces/3/3/photos", contentType, body, &space); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload = %d %+v", resp.StatusCode, space)
+	}
+	if !space.Completed || space.Hero == nil || len(space.Photos) != 1 || space.Photos[0].Caption != "from the API" {
+		t.Fatalf("space after upload = %+v", space)
+	}
+	if exists, err := blobs.Exists(context.Background(), space.Photos[0].Key); err != nil || !exists {
+		t.Errorf("uploaded image exists = %t, %v", exists, err)
+	}
+
+	contentType, body = uploadBody(t, make([]byte, maxUploadSize+1))
+	var res APIError
+	resp := apiRequest(t, srv, "alice", http.MethodPost, "/spaces/3/4/photos", contentType, body, &res)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || res.Error.Code != "too_large" {
+		t.Errorf("oversized upload = %d %+v, want 413 too_large", resp.StatusCode, res)
+	}
+}
+
+func TestAPILeaderboard(t *testing.T) {
+	srv := testAPI(t)
+	var lb APILeaderboard
+	if resp := apiRequest(t, srv, "alice", http.MethodGet, "/leaderboard", "", nil, &lb); resp.StatusCode != http.StatusOK {
+		t.Fatalf("leaderboard = %d", resp.StatusCode)
+	}
+	if lb.Phase != "playing" || len(lb.Rows) == 0 {
+		t.Fatalf("leaderboard = %+v", lb)
+	}
+	if row := lb.Rows[0]; row.Rank != 1 || row.Player != "alice" || row.Completed != 2 {
+		t.Errorf("first row = %+v, want alice with the free space and one completed space", row)
+	}
+}
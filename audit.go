@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AuditEntry records a change to the game state, for settling disputes and reviewing moderation.
+type AuditEntry struct {
+	At     time.Time  `json:"at"`
+	Actor  PlayerName `json:"actor,omitempty"` // empty for commands run by an administrator
+	Action string     `json:"action"`
+	Player PlayerName `json:"player,omitempty"` // whose board, photo or account was affected
+	Target string     `json:"target,omitempty"` // e.g. a space or [Photo.Key]
+	Before string     `json:"before,omitempty"`
+	After  string     `json:"after,omitempty"`
+	Detail string     `json:"detail,omitempty"`
+}
+
+func (gs *GameState) audit(e AuditEntry) {
+	gs.AuditLog = append(gs.AuditLog, e)
+}
+
+// spaceTarget describes a space for the [AuditEntry.Target].
+func spaceTarget(x, y int, space *BingoSpace) string {
+	return fmt.Sprintf("%d/%d %s", x, y, space.goal().Name)
+}
+
+// AuditQuery selects audit log entries, empty fields match everything.
+type AuditQuery struct {
+	Actor  PlayerName
+	Player PlayerName
+	Action string
+	Since  time.Time
+	Until  time.Time
+}
+
+// parseAuditQuery reads a query from form values or flags named like the lowercase fields.
+// Since and Until are dates or RFC 3339 timestamps, with a date for Until including the whole day.
+func parseAuditQuery(get func(name string) string) (AuditQuery, error) {
+	q := AuditQuery{
+		Actor:  PlayerName(get("actor")),
+		Player: PlayerName(get("player")),
+		Action: get("action"),
+	}
+	var err error
+	if q.Since, err = parseGameTime(get("since"), false); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseGameTime(get("until"), true); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func (q *AuditQuery) matches(e *AuditEntry) bool {
+	return (q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Player == "" || e.Player == q.Player) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.Since.IsZero() || !e.At.Before(q.Since)) &&
+		(q.Until.IsZero() || e.At.Before(q.Until))
+}
+
+// queryAudit returns the matching audit log entries, oldest first.
+func (gs *GameState) queryAudit(q AuditQuery) []AuditEntry {
+	var res []AuditEntry
+	for _, e := range gs.AuditLog {
+		if q.matches(&e) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// recentAudit returns the latest n entries of the audit log, newest first.
+func recentAudit(entries []AuditEntry, n int) []AuditEntry {
+	res := slices.Clone(entries[max(0, len(entries)-n):])
+	slices.Reverse(res)
+	return res
+}
+
+type AuditData struct {
+	BaseURL string
+	Query   AuditQuery
+	Actions []string // all actions in the log, for filtering
+	Entries []AuditEntry
+	Total   int // number of matching entries, of which only the latest are shown
+	// URLs for exporting all matching entries
+	ExportCSV, ExportJSON string
+}
+
+// auditData returns the data for the audit log page, whose query parameters are given for the export links.
+func (gs *GameState) auditData(q AuditQuery, params url.Values) AuditData {
+	matching := gs.queryAudit(q)
+	res := AuditData{
+		BaseURL: basePath,
+		Query:   q,
+		Entries: recentAudit(matching, maxAuditEntriesShown),
+		Total:   len(matching),
+	}
+	params = maps.Clone(params)
+	params.Set("format", "csv")
+	res.ExportCSV = basePath + "/audit?" + params.Encode()
+	params.Set("format", "json")
+	res.ExportJSON = basePath + "/audit?" + params.Encode()
+	for _, e := range gs.AuditLog {
+		if !slices.Contains(res.Actions, e.Action) {
+			res.Actions = append(res.Actions, e.Action)
+		}
+	}
+	slices.Sort(res.Actions)
+	return res
+}
+
+// exportAudit writes audit log entries as "json" or "csv".
+func exportAudit(w io.Writer, format string, entries []AuditEntry) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if entries == nil {
+			entries = []AuditEntry{}
+		}
+		return enc.Encode(entries)
+	case "csv":
+		return writeAuditCSV(w, entries)
+	default:
+		return fmt.Errorf("invalid export format %q, must be json or csv", format)
+	}
+}
+
+// writeAuditCSV exports audit log entries as CSV with a header row.
+func writeAuditCSV(w io.Writer, entries []AuditEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"at", "actor", "action", "player", "target", "before", "after", "detail"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.At.Format(time.RFC3339Nano),
+			csvCell(string(e.Actor)),
+			csvCell(e.Action),
+			csvCell(string(e.Player)),
+			csvCell(e.Target),
+			csvCell(e.Before),
+			csvCell(e.After),
+			csvCell(e.Detail),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell keeps player provided text, like captions, from being run as a formula by spreadsheets.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func joinPlayers(players []PlayerName) string {
+	names := make([]string, len(players))
+	for i, p := range players {
+		names[i] = string(p)
+	}
+	return strings.Join(names, ", ")
+}
+
+// joinKeys lists photo keys for [AuditEntry.Before] and [AuditEntry.After].
+func joinKeys(photos []Photo) string {
+	keys := make([]string, len(photos))
+	for i, photo := range photos {
+		keys[i] = photo.Key
+	}
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteAuditCSVEscapesFormulas(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	entries := []AuditEntry{
+		{At: at, Actor: "=cmd", Action: "caption", Player: "@bob", Target: "+1", Before: "-2", After: "\tx", Detail: "\r=HYPERLINK(\"http://example.com\")"},
+		{At: at, Actor: "alice", Action: "caption", Player: "alice", Target: "a=b", Detail: "x - y"},
+	}
+	var buf bytes.Buffer
+	if err := writeAuditCSV(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"at", "actor", "action", "player", "target", "before", "after", "detail"},
+		{"2026-10-01T12:00:00Z", "'=cmd", "caption", "'@bob", "'+1", "'-2", "'\tx", "'\r=HYPERLINK(\"http://example.com\")"},
+		{"2026-10-01T12:00:00Z", "alice", "caption", "alice", "a=b", "", "", "x - y"},
+	}
+	if !slices.EqualFunc(rows, want, slices.Equal) {
+		t.Errorf("CSV rows = %q, want %q", rows, want)
+	}
+}
@@ -10,7 +10,11 @@ import (
 	"time"
 )
 
-const authCookie = "session_id"
+const (
+	authCookie = "session_id"
+	// identifies the browser independently of the account, to detect multiple accounts being used from it
+	deviceCookie = "device_id"
+)
 
 var authEncoding = base64.URLEncoding
 
@@ -41,6 +45,8 @@ func checkAuth(r *http.Request) (*PlayerName, error) {
 
 			} else if token.Password != p.Password { // FIXME this obviously cannot stay, add some kind of SSO or something
 				err = fmt.Errorf("%d: invalid password", i)
+			} else if p.Suspended {
+				err = fmt.Errorf("%d: %s has been suspended", i, token.User)
 			}
 		})
 		if err != nil {
@@ -67,21 +73,25 @@ func signUp(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return fmt.Errorf("generating password: %w", err)
 	}
+	device, err := deviceID(w, r)
+	if err != nil {
+		return err
+	}
 	token.Password = InsecurePlaintextPassword(pw)
 	tokenJSON, err := json.Marshal(token)
 	if err != nil {
 		return fmt.Errorf("encoding session ID: %w", err)
 	}
 	tokenB64 := base64.URLEncoding.EncodeToString(tokenJSON)
-	gameState.Modify(func(gs GameState) GameState {
+	err = gameState.ModifyE(func(gs GameState) (GameState, error) {
 		_, ok := gs.Players[token.User]
 		if ok {
-			err = fmt.Errorf("user name %q already taken", token.User)
-			return gs
+			return gs, fmt.Errorf("user name %q already taken", token.User)
 		}
 		ps := PlayerState{
 			Password: token.Password,
 			Approved: false,
+			Devices:  []string{device},
 			Board:    generateBoard(),
 		}
 		if gs.Players == nil {
@@ -91,7 +101,8 @@ func signUp(w http.ResponseWriter, r *http.Request) error {
 		} else {
 			gs.Players[token.User] = ps
 		}
-		return gs
+		gs.audit(AuditEntry{At: time.Now(), Actor: token.User, Action: "signup", Player: token.User})
+		return gs, nil
 	})
 	if err != nil {
 		return err
@@ -109,6 +120,27 @@ func signUp(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// deviceID returns the ID stored in the [deviceCookie], generating and setting a new one if there is none.
+func deviceID(w http.ResponseWriter, r *http.Request) (string, error) {
+	if c, err := r.Cookie(deviceCookie); err == nil && c.Value != "" {
+		return c.Value, nil
+	}
+	id, err := randStr(12)
+	if err != nil {
+		return "", fmt.Errorf("generating device ID: %w", err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     deviceCookie,
+		Value:    id,
+		HttpOnly: true,
+		Secure:   true,
+		Path:     basePath,
+		SameSite: http.SameSiteStrictMode,
+		Expires:  time.Now().AddDate(1, 0, 0),
+	})
+	return id, nil
+}
+
 // note that the result is base64-encoded, leading to a longer length than the given number of bytes
 func randStr(bytes int) (string, error) {
 	randBytes := make([]byte, bytes)
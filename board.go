@@ -1,6 +1,10 @@
 package main
 
-import "math/rand/v2"
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+)
 
 type Goal struct {
 	Name        string
@@ -13,10 +17,13 @@ const freeGoalIdx = -1
 
 // DisplayBingoSpace is a denormalized [BingoSpace] for template rendering.
 type DisplayBingoSpace struct {
-	Goal      Goal
-	Completed bool
-	Image     string
-	Locked    bool
+	Goal       Goal
+	Completed  bool
+	Review     ReviewStatus  // only relevant if verification is required
+	Rejection  string        // reason of the rejection, if the review status is rejected
+	Hero       *DisplayPhoto // the photo submitted for this space, nil if there is none
+	Alternates []DisplayPhoto
+	Locked     bool
 }
 type DisplayBingoRow [5]DisplayBingoSpace
 type DisplayBingoBoard [5]DisplayBingoRow
@@ -36,24 +43,73 @@ func (board *BingoBoard) display() DisplayBingoBoard {
 	return res
 }
 
-func (space *BingoSpace) display() DisplayBingoSpace {
-	isFreeGoal := space.GoalIdx == freeGoalIdx
-	goal := freeGoal
-	if !isFreeGoal {
-		goal = options[space.GoalIdx]
+// gameData returns what the player's board page shows.
+func (gs *GameState) gameData(user PlayerName) GameData {
+	ps := gs.Players[user]
+	res := GameData{
+		BaseURL:      basePath,
+		User:         user,
+		Moderator:    ps.Moderator,
+		Board:        ps.Board.display(),
+		Score:        ps.Board.score(gs.Settings),
+		Verification: gs.Settings.verifiers() != VerifyNone,
+	}
+	for _, n := range slices.Backward(gs.Notifications[user]) {
+		res.Notifications = append(res.Notifications, n)
+	}
+	return res
+}
+
+// spaceLock returns why the space can't be changed, or nil if it can.
+func (gs *GameState) spaceLock(space *BingoSpace) error {
+	switch {
+	case gs.Settings.Phase != PhasePlaying:
+		// boards are frozen once the game is over
+		return errors.New("the game is over, boards can no longer be changed")
+	case space.GoalIdx == freeGoalIdx:
+		return errors.New("the free space is always completed")
+	}
+	return nil
+}
+
+func (space *BingoSpace) goal() Goal {
+	if space.GoalIdx == freeGoalIdx {
+		return freeGoal
 	}
-	return DisplayBingoSpace{
-		Goal:      goal,
+	return options[space.GoalIdx]
+}
+
+// display converts the space for template rendering.
+// Photos don't include comments and reactions, see [GameState.displayPhoto].
+func (space *BingoSpace) display() DisplayBingoSpace {
+	res := DisplayBingoSpace{
+		Goal:      space.goal(),
 		Completed: space.Completed,
-		Locked:    isFreeGoal,
-		Image:     space.Image,
+		Review:    space.reviewStatus(),
+		Locked:    space.GoalIdx == freeGoalIdx,
 	}
+	if res.Review == ReviewRejected {
+		res.Rejection = space.Review.Reason
+	}
+	for _, photo := range space.Photos {
+		dp := photo.display()
+		if photo.Key == space.Hero {
+			res.Hero = &dp
+		} else {
+			res.Alternates = append(res.Alternates, dp)
+		}
+	}
+	return res
 }
 
 type BingoSpace struct {
-	GoalIdx   int    `json:"ix"` // index into [options] or [freeGoalIdx]
-	Completed bool   `json:"ok"`
-	Image     string `json:"img"` // empty = none
+	GoalIdx   int     `json:"ix"` // index into [options] or [freeGoalIdx]
+	Completed bool    `json:"ok"`
+	Photos    []Photo `json:"photos,omitempty"`
+	Hero      string  `json:"hero,omitempty"` // [Photo.Key] of the photo submitted for this space
+	Review    *Review `json:"review,omitempty"`
+	// Deprecated: old state files only had a single image per space, see [migrateSingleImage]
+	Image string `json:"img,omitempty"`
 }
 
 type BingoRow [5]BingoSpace
@@ -63,7 +119,8 @@ func (board *BingoBoard) get(x, y int) *BingoSpace {
 	return &(*board)[y][x]
 }
 
-func (board *BingoBoard) score() int {
+// score returns the number of bingos, only counting spaces which have been verified if required.
+func (board *BingoBoard) score(settings GameSettings) int {
 	var (
 		rows  [5]int
 		cols  [5]int
@@ -71,15 +128,15 @@ func (board *BingoBoard) score() int {
 	)
 	for x := range 5 {
 		for y := range 5 {
-			if board.get(x, y).Completed {
+			if board.get(x, y).counts(settings) {
 				cols[x]++
 				rows[y]++
 			}
 		}
-		if board.get(x, x).Completed {
+		if board.get(x, x).counts(settings) {
 			diags[0]++
 		}
-		if board.get(x, 4-x).Completed {
+		if board.get(x, 4-x).counts(settings) {
 			diags[1]++
 		}
 	}
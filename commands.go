@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// runCommand executes an administrative command given on the command line instead of serving.
+// Commands which modify the state must not be run while the server is running, or their changes will be overwritten.
+func runCommand(ctx context.Context, name string, args []string) error {
+	switch name {
+	case "gc":
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "only report orphaned and missing images, don't change anything")
+		flags.Parse(args)
+		report, err := collectGarbage(ctx, time.Now(), *dryRun)
+		for _, key := range report.Orphaned {
+			fmt.Printf("orphaned: %s\n", key)
+		}
+		for _, key := range report.Missing {
+			fmt.Printf("missing:  %s\n", key)
+		}
+		for _, key := range report.Deleted {
+			if *dryRun {
+				fmt.Printf("would delete: %s\n", key)
+			} else {
+				fmt.Printf("deleted: %s\n", key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if *dryRun {
+			return nil
+		}
+		return writeState()
+	case "promote", "demote":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <player>", name)
+		}
+		err := modifyPlayer(PlayerName(args[0]), name, func(ps *PlayerState) (before, after string) {
+			before = strconv.FormatBool(ps.Moderator)
+			ps.Moderator = name == "promote"
+			return before, strconv.FormatBool(ps.Moderator)
+		})
+		if err != nil {
+			return err
+		}
+		return writeState()
+	case "set-team":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s <player> <team>", name)
+		}
+		err := modifyPlayer(PlayerName(args[0]), name, func(ps *PlayerState) (before, after string) {
+			before = ps.Team
+			ps.Team = args[1]
+			return before, ps.Team
+		})
+		if err != nil {
+			return err
+		}
+		return writeState()
+	case "audit":
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		format := flags.String("format", "csv", "json or csv")
+		for _, f := range []string{"actor", "player", "action", "since", "until"} {
+			flags.String(f, "", "only export entries with this "+f)
+		}
+		flags.Parse(args)
+		q, err := parseAuditQuery(func(name string) string {
+			return flags.Lookup(name).Value.String()
+		})
+		if err != nil {
+			return err
+		}
+		var entries []AuditEntry
+		gameState.Read(func(gs GameState) {
+			entries = gs.queryAudit(q)
+		})
+		return exportAudit(os.Stdout, *format, entries)
+	case "snapshots":
+		if !snapshotsKept() {
+			return errSnapshotsNotKept
+		}
+		snapshots, err := listSnapshots()
+		if err != nil {
+			return err
+		}
+		for _, s := range snapshots {
+			fmt.Printf("%s\t%s\t%d bytes\n", s.Name, s.Time.Local().Format(time.DateTime), s.Size)
+		}
+		return nil
+	case "restore":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <snapshot>", name)
+		}
+		return restoreSnapshot(args[0], "", time.Now())
+	case "migrate-sqlite":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <database>", name)
+		}
+		if _, ok := store.(*JSONFileStore); !ok {
+			return fmt.Errorf("unset PHOTO_BINGO_SQLITE to migrate from %q", latestStatePath)
+		}
+		if err := migrateToSQLite(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("migrated to %s, set PHOTO_BINGO_SQLITE=%s to use it\n", args[0], args[0])
+		return nil
+	case "settings":
+		var settings GameSettings
+		gameState.Read(func(gs GameState) {
+			settings = gs.Settings
+		})
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		visibility := flags.String("visibility", string(settings.ImageVisibility), "who may see images before the gallery is published: owner, team or players")
+		flags.BoolVar(&settings.GalleryPublished, "publish", settings.GalleryPublished, "make all images visible to everyone")
+		flags.BoolVar(&settings.CommentsDisabled, "no-comments", settings.CommentsDisabled, "disallow commenting on photos")
+		flags.BoolVar(&settings.ReactionsDisabled, "no-reactions", settings.ReactionsDisabled, "disallow reacting to photos")
+		completion := flags.String("completion", string(settings.Completion), "what completing a space requires: honor (nothing), photo or verified (a photo which has to be verified)")
+		verification := flags.String("verification", string(settings.Verification), "who verifies spaces with -completion=verified: moderator or peers, otherwise none")
+		flags.IntVar(&settings.RequiredApprovals, "approvals", settings.RequiredApprovals, "number of other players who must approve a space with -verification=peers")
+		start := flags.String("start", formatGameTime(settings.Start), "when the game starts, as YYYY-MM-DD or RFC 3339; photos taken before are flagged for moderators")
+		end := flags.String("end", formatGameTime(settings.End), "when the game ends (a date includes the whole day); photos taken after are flagged for moderators")
+		phase := flags.String("phase", string(settings.Phase), "playing, voting (boards are frozen and players vote on photos) or ended (votes are tallied)")
+		flags.BoolVar(&settings.BlockDuplicates, "block-duplicates", settings.BlockDuplicates, "reject near-duplicate uploads instead of flagging them for moderators")
+		flags.Parse(args)
+		var err error
+		settings.ImageVisibility, err = parseImageVisibility(*visibility)
+		if err != nil {
+			return err
+		}
+		settings.Phase, err = parseGamePhase(*phase)
+		if err != nil {
+			return err
+		}
+		settings.Verification, err = parseVerificationMode(*verification)
+		if err != nil {
+			return err
+		}
+		settings.Completion, err = parseCompletionPolicy(*completion)
+		if err != nil {
+			return err
+		}
+		settings.Start, err = parseGameTime(*start, false)
+		if err != nil {
+			return err
+		}
+		settings.End, err = parseGameTime(*end, true)
+		if err != nil {
+			return err
+		}
+		switch {
+		case settings.Completion == CompleteVerified && settings.Verification == VerifyNone:
+			return errors.New("-completion=verified requires -verification=moderator or peers")
+		case settings.Completion != CompleteVerified && settings.Verification != VerifyNone:
+			// spaces completed without a photo couldn't be verified
+			return errors.New("-verification=moderator or peers requires -completion=verified")
+		}
+		gameState.Modify(func(gs GameState) GameState {
+			gs.audit(AuditEntry{
+				At:     time.Now(),
+				Action: name,
+				Before: fmt.Sprintf("%+v", gs.Settings),
+				After:  fmt.Sprintf("%+v", settings),
+			})
+			gs.Settings = settings
+			return gs
+		})
+		fmt.Printf("%+v\n", settings)
+		return writeState()
+	default:
+		fmt.Fprintf(os.Stderr, "usage: %s [gc [-dry-run] | snapshots | restore <snapshot> | migrate-sqlite <database> | audit [-format=csv|json] [-actor=...] [-player=...] [-action=...] [-since=...] [-until=...] | promote <player> | demote <player> | set-team <player> <team> | settings [-visibility=...] [-publish] [-block-duplicates] [-no-comments] [-no-reactions] [-completion=...] [-start=...] [-end=...] [-verification=... [-approvals=N]] [-phase=...]]\n", os.Args[0])
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// parseGameTime parses a date or RFC 3339 timestamp, returning the zero time for an empty string.
+// If endOfDay is set, a date refers to the end of that day rather than its start.
+func parseGameTime(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, must be YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
+}
+
+func formatGameTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// modifyPlayer applies f to a player's state and records the change in the audit log.
+func modifyPlayer(name PlayerName, action string, f func(ps *PlayerState) (before, after string)) error {
+	return gameState.ModifyE(func(gs GameState) (GameState, error) {
+		ps, ok := gs.Players[name]
+		if !ok {
+			return gs, fmt.Errorf("unknown player %q", name)
+		}
+		before, after := f(&ps)
+		gs.Players[name] = ps
+		gs.audit(AuditEntry{At: time.Now(), Action: action, Player: name, Before: before, After: after})
+		return gs, nil
+	})
+}
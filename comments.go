@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// reactionEmoji are the reactions players can give to photos.
+var reactionEmoji = []string{"❤️", "😂", "😮", "👏", "🔥"}
+
+// Comment is a remark by a player on a photo.
+type Comment struct {
+	ID      string       `json:"id"`
+	Author  PlayerName   `json:"author"`
+	Text    string       `json:"text"`
+	At      time.Time    `json:"at"`
+	Hidden  bool         `json:"hidden,omitempty"` // by a moderator, only visible to moderators
+	Reports []PlayerName `json:"reports,omitempty"`
+}
+
+// Notification tells a player that someone interacted with one of their photos.
+type Notification struct {
+	At    time.Time  `json:"at"`
+	From  PlayerName `json:"from"`
+	Photo string     `json:"photo"` // [Photo.Key]
+	Emoji string     `json:"emoji,omitempty"`
+	// set if it's about a comment rather than a reaction
+	Comment string `json:"comment,omitempty"`
+}
+
+// DisplayComment is a [Comment] for template rendering.
+type DisplayComment struct {
+	Comment
+	CanDelete bool
+}
+
+// DisplayReaction is the number of players who reacted to a photo with an emoji.
+type DisplayReaction struct {
+	Emoji string
+	Count int
+	Mine  bool // whether the viewer reacted with this emoji
+}
+
+func (gs *GameState) addComment(author PlayerName, key string, text string, now time.Time) error {
+	if gs.Settings.CommentsDisabled {
+		return errors.New("comments are disabled")
+	}
+	if text == "" {
+		return errors.New("empty comment")
+	}
+	if len(text) > maxCommentLength {
+		return fmt.Errorf("comment too long, limit %d characters", maxCommentLength)
+	}
+	id, err := randStr(6)
+	if err != nil {
+		return fmt.Errorf("generating comment ID: %w", err)
+	}
+	if gs.Comments == nil {
+		gs.Comments = map[string][]Comment{}
+	}
+	gs.Comments[key] = append(gs.Comments[key], Comment{ID: id, Author: author, Text: text, At: now})
+	gs.notify(author, key, Notification{At: now, From: author, Photo: key, Comment: text})
+	return nil
+}
+
+func (gs *GameState) comment(key string, id string) *Comment {
+	comments := gs.Comments[key]
+	i := slices.IndexFunc(comments, func(c Comment) bool { return c.ID == id })
+	if i < 0 {
+		return nil
+	}
+	return &comments[i]
+}
+
+// deleteComment removes a comment, which only its author and moderators may do.
+func (gs *GameState) deleteComment(actor PlayerName, key string, id string, now time.Time) error {
+	c := gs.comment(key, id)
+	if c == nil {
+		return fmt.Errorf("no comment %q", id)
+	}
+	if c.Author != actor && !gs.Players[actor].Moderator {
+		return errors.New("only the author and moderators may delete a comment")
+	}
+	if c.Author != actor {
+		gs.audit(AuditEntry{At: now, Actor: actor, Action: "delete-comment", Player: c.Author, Target: key, Before: c.Text})
+	}
+	gs.Comments[key] = slices.DeleteFunc(gs.Comments[key], func(c Comment) bool { return c.ID == id })
+	if len(gs.Comments[key]) == 0 {
+		delete(gs.Comments, key)
+	}
+	return nil
+}
+
+func (gs *GameState) setCommentHidden(actor PlayerName, key string, id string, hidden bool, now time.Time) error {
+	if !gs.Players[actor].Moderator {
+		return errors.New("only moderators may hide comments")
+	}
+	c := gs.comment(key, id)
+	if c == nil {
+		return fmt.Errorf("no comment %q", id)
+	}
+	c.Hidden = hidden
+	action := "unhide-comment"
+	if hidden {
+		action = "hide-comment"
+	}
+	gs.audit(AuditEntry{At: now, Actor: actor, Action: action, Player: c.Author, Target: key, Detail: c.Text})
+	// either way, a moderator has dealt with the reports
+	c.Reports = nil
+	return nil
+}
+
+func (gs *GameState) reportComment(reporter PlayerName, key string, id string) error {
+	c := gs.comment(key, id)
+	if c == nil {
+		return fmt.Errorf("no comment %q", id)
+	}
+	if !slices.Contains(c.Reports, reporter) {
+		c.Reports = append(c.Reports, reporter)
+	}
+	return nil
+}
+
+// toggleReaction sets the player's reaction to a photo, or removes it if it's the same as before.
+func (gs *GameState) toggleReaction(player PlayerName, key string, emoji string, now time.Time) error {
+	if gs.Settings.ReactionsDisabled {
+		return errors.New("reactions are disabled")
+	}
+	if !slices.Contains(reactionEmoji, emoji) {
+		return fmt.Errorf("invalid reaction %q", emoji)
+	}
+	if gs.Reactions == nil {
+		gs.Reactions = map[string]map[PlayerName]string{}
+	}
+	if gs.Reactions[key] == nil {
+		gs.Reactions[key] = map[PlayerName]string{}
+	}
+	if gs.Reactions[key][player] == emoji {
+		delete(gs.Reactions[key], player)
+		if len(gs.Reactions[key]) == 0 {
+			delete(gs.Reactions, key)
+		}
+		return nil
+	}
+	gs.Reactions[key][player] = emoji
+	gs.notify(player, key, Notification{At: now, From: player, Photo: key, Emoji: emoji})
+	return nil
+}
+
+// notify adds a notification for the owner of the photo, unless they did it themselves.
+func (gs *GameState) notify(actor PlayerName, key string, n Notification) {
+	owner, ok := gs.imageOwner(key)
+	if !ok || owner == actor {
+		return
+	}
+	if gs.Notifications == nil {
+		gs.Notifications = map[PlayerName][]Notification{}
+	}
+	ns := append(gs.Notifications[owner], n)
+	if len(ns) > maxNotifications {
+		ns = ns[len(ns)-maxNotifications:]
+	}
+	gs.Notifications[owner] = ns
+}
+
+// displayComments returns the comments on a photo the viewer may see.
+func (gs *GameState) displayComments(viewer *PlayerName, key string) []DisplayComment {
+	isModerator := viewer != nil && gs.Players[*viewer].Moderator
+	var res []DisplayComment
+	for _, c := range gs.Comments[key] {
+		if c.Hidden && !isModerator {
+			continue
+		}
+		res = append(res, DisplayComment{
+			Comment:   c,
+			CanDelete: viewer != nil && (c.Author == *viewer || isModerator),
+		})
+	}
+	return res
+}
+
+func (gs *GameState) displayReactions(viewer *PlayerName, key string) []DisplayReaction {
+	res := make([]DisplayReaction, len(reactionEmoji))
+	for i, emoji := range reactionEmoji {
+		res[i].Emoji = emoji
+	}
+	for player, emoji := range gs.Reactions[key] {
+		i := slices.Index(reactionEmoji, emoji)
+		if i < 0 {
+			continue
+		}
+		res[i].Count++
+		if viewer != nil && player == *viewer {
+			res[i].Mine = true
+		}
+	}
+	return res
+}
+
+// ReportedComment is a comment players have reported, for moderators to review.
+type ReportedComment struct {
+	Photo string // [Photo.Key]
+	Comment
+}
+
+func (gs *GameState) reportedComments() []ReportedComment {
+	var res []ReportedComment
+	for key, comments := range gs.Comments {
+		for _, c := range comments {
+			if len(c.Reports) > 0 {
+				res = append(res, ReportedComment{Photo: key, Comment: c})
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b ReportedComment) int {
+		return b.At.Compare(a.At)
+	})
+	return res
+}
+
+type PhotoPageData struct {
+	BaseURL   string
+	User      PlayerName // empty if not signed in
+	Moderator bool
+	Owner     PlayerName
+	Goal      Goal
+	Photo     DisplayPhoto
+	Hidden    bool
+	Reported  bool // by the viewer
+	// whether the viewer may comment or react
+	CanComment bool
+	CanReact   bool
+}
+
+// photoPage returns the data for viewing a single photo along with its comments and reactions.
+// Access has to be checked beforehand.
+func (gs *GameState) photoPage(viewer *PlayerName, key string) (PhotoPageData, bool) {
+	loc, ok := gs.locatePhoto(key)
+	if !ok {
+		return PhotoPageData{}, false
+	}
+	res := PhotoPageData{
+		BaseURL: basePath,
+		Owner:   loc.Player,
+		Goal:    loc.Goal,
+		Photo:   gs.displayPhoto(viewer, loc.Photo),
+		Hidden:  loc.Photo.Hidden,
+	}
+	if viewer != nil {
+		res.User = *viewer
+		res.Moderator = gs.Players[*viewer].Moderator
+		res.CanComment = !gs.Settings.CommentsDisabled
+		res.CanReact = !gs.Settings.ReactionsDisabled
+		res.Reported = slices.Contains(loc.Photo.Reports, *viewer)
+	}
+	return res, true
+}
+
+// displaySpace is like [BingoSpace.display], including the comments and reactions the viewer may see.
+func (gs *GameState) displaySpace(viewer *PlayerName, space *BingoSpace) DisplayBingoSpace {
+	res := space.display()
+	if res.Hero != nil {
+		hero := gs.displayPhoto(viewer, *space.photo(space.Hero))
+		res.Hero = &hero
+	}
+	for i := range res.Alternates {
+		res.Alternates[i] = gs.displayPhoto(viewer, *space.photo(res.Alternates[i].Key))
+	}
+	return res
+}
+
+// displayPhoto is like [Photo.display], including the comments and reactions the viewer may see.
+func (gs *GameState) displayPhoto(viewer *PlayerName, photo Photo) DisplayPhoto {
+	res := photo.display()
+	res.Comments = gs.displayComments(viewer, photo.Key)
+	if !gs.Settings.ReactionsDisabled {
+		res.Reactions = gs.displayReactions(viewer, photo.Key)
+	}
+	return res
+}
@@ -1,16 +1,59 @@
 package main
 
+import "time"
+
 const (
 	basePath          = "/photo-bingo"
-	imagePath         = "images"
+	imagePath         = "images" // URL path of images, and their directory when stored locally
+	apiPath           = "api/v1" // URL path of the JSON API, see openapi.yaml
+	signedURLExpiry   = time.Hour
 	verbose           = true
 	maxUploadSize     = 5 * 1024 * 1024 // when changing this, adjust space.html
+	maxImagePixels    = 50_000_000      // uploads are rejected before decoding them if they claim more
 	maxUsernameLength = 64
 
+	thumbnailSize = 160 // edge length of the square thumbnails shown on the board
+
+	maxPhotosPerSpace   = 5
+	maxStoragePerPlayer = 100 * 1024 * 1024
+	maxCaptionLength    = 280 // when changing this, adjust space.html
+
+	galleryPageSize = 24
+
+	maxCommentLength = 1000 // when changing this, adjust photo.html
+	maxNotifications = 50   // per player, older ones are dropped
+
+	maxDuplicateHashDistance = 6 // photos whose perceptual hashes differ in at most this many bits are considered duplicates
+
+	maxAuditEntriesShown = 100 // on the moderation page
+
+	imageGCInterval    = time.Hour
+	imageGCGracePeriod = 7 * 24 * time.Hour // how long replaced images are kept before being deleted
+
 	latestStatePath   = "state.json"
 	previousStatePath = "state.prev.json"
+	journalPath       = "state.journal" // changes since the snapshot in latestStatePath
+	stateLockPath     = "state.lock"    // held by the process using the state, be it the server or a command
+	maxJournalRecords = 1000            // when reached, the journal is compacted into a new snapshot
+	snapshotDir       = "snapshots"     // timestamped copies of previous snapshots
+	snapshotInterval  = time.Hour       // the journal is compacted at least this often, if there were changes
+
+	saveDebounce = time.Second      // changes are saved once there were none for this long
+	saveMaxDelay = 10 * time.Second // but no later than this after the first unsaved change, and failed saves are retried after this
+
+	liveKeepAlive = 30 * time.Second // live update connections get a comment this often, so proxies don't close them
 )
 
+// old snapshots are thinned out to one per bucket, and deleted once they're older than the last tier
+var snapshotRetention = []SnapshotRetention{
+	{Bucket: time.Minute, For: time.Hour},
+	{Bucket: time.Hour, For: 24 * time.Hour},
+	{Bucket: 24 * time.Hour, For: 30 * 24 * time.Hour},
+}
+
+// widths of the resized variants of each upload offered to browsers via srcset
+var imageVariantWidths = []int{480, 960, 1920}
+
 var options = [5*5 - 1]Goal{
 	{Name: "Shadows", Description: "Make shadows the main subject of your photograph. Focus on their shapes, patterns, and how they define or obscure light."},
 	{Name: "Mostly dark", Description: "Create a high-contrast image where the majority of the frame is dark (low-key). Focus on using small amounts of light to highlight your subject."},
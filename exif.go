@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"time"
+)
+
+const (
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// jpegExif returns the TIFF structure of the EXIF segment of a JPEG, or nil if there is none.
+func jpegExif(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	data = data[2:]
+	for len(data) >= 4 && data[0] == 0xFF {
+		marker := data[1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image: no more metadata
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(data[2:4]))
+		if size < 2 || len(data) < 2+size {
+			return nil
+		}
+		segment := data[4 : 2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		data = data[2+size:]
+	}
+	return nil
+}
+
+// exifIFD0 reads the first image file directory of a TIFF structure into a map from tag to raw 4-byte value.
+func exifIFD0(tiff []byte) (map[uint16][]byte, binary.ByteOrder, error) {
+	if len(tiff) < 8 {
+		return nil, nil, errors.New("truncated TIFF header")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, nil, errors.New("invalid TIFF byte order")
+	}
+	tags, err := exifIFD(tiff, order, order.Uint32(tiff[4:8]))
+	return tags, order, err
+}
+
+func exifIFD(tiff []byte, order binary.ByteOrder, offset uint32) (map[uint16][]byte, error) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return nil, errors.New("IFD offset out of range")
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	entries := tiff[offset+2:]
+	if len(entries) < count*12 {
+		return nil, errors.New("truncated IFD")
+	}
+	res := make(map[uint16][]byte, count)
+	for i := range count {
+		entry := entries[i*12 : (i+1)*12]
+		res[order.Uint16(entry)] = entry[8:12]
+	}
+	return res, nil
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, defaulting to 1 (upright).
+func jpegOrientation(data []byte) int {
+	tiff := jpegExif(data)
+	if tiff == nil {
+		return 1
+	}
+	tags, order, err := exifIFD0(tiff)
+	if err != nil {
+		return 1
+	}
+	value, ok := tags[exifTagOrientation]
+	if !ok {
+		return 1
+	}
+	orientation := int(order.Uint16(value)) // SHORT values are left-aligned in the value field
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// jpegDateTaken returns when a JPEG was taken according to its EXIF data, or the zero time if unknown.
+// EXIF dates carry no time zone, so they are interpreted in the server's.
+func jpegDateTaken(data []byte) time.Time {
+	tiff := jpegExif(data)
+	if tiff == nil {
+		return time.Time{}
+	}
+	tags, order, err := exifIFD0(tiff)
+	if err != nil {
+		return time.Time{}
+	}
+	value, ok := tags[exifTagDateTime]
+	if offset, found := tags[exifTagExifIFD]; found {
+		if exifTags, err := exifIFD(tiff, order, order.Uint32(offset)); err == nil {
+			if original, found := exifTags[exifTagDateTimeOriginal]; found {
+				value, ok = original, true
+			}
+		}
+	}
+	if !ok {
+		return time.Time{}
+	}
+	// the 20 byte string doesn't fit into the value, so it holds an offset
+	offset := order.Uint32(value)
+	const layout = "2006:01:02 15:04:05"
+	if uint64(offset)+uint64(len(layout)) > uint64(len(tiff)) {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(layout, string(tiff[offset:offset+uint32(len(layout))]), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// applyOrientation transforms an image as described by its EXIF orientation, so it is displayed upright.
+// Derived images carry no EXIF data, so this has to be baked into their pixels.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	swap := orientation >= 5 // orientations 5-8 are rotated by 90°
+	dstW, dstH := w, h
+	if swap {
+		dstW, dstH = h, w
+	}
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			i := src.PixOffset(x, y)
+			j := dst.PixOffset(dx, dy)
+			copy(dst.Pix[j:j+4], src.Pix[i:i+4])
+		}
+	}
+	return dst
+}
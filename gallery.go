@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type GalleryData struct {
+	BaseURL string
+	Title   string
+	Phase   GamePhase
+	// on the gallery index: links to the per-goal and per-player pages
+	Goals   []GalleryLink
+	Players []GalleryLink
+	// on the gallery index once the game has ended
+	Awards  []GalleryEntry
+	Overall []PlayerName
+	// on a per-goal or per-player page
+	Entries   []GalleryEntry
+	Page      int // 1-based
+	PageCount int
+}
+
+type GalleryLink struct {
+	Name  string
+	Path  string // relative to [basePath]
+	Count int    // number of visible photos
+}
+
+// GalleryEntry is a submitted photo shown in the gallery.
+type GalleryEntry struct {
+	Player   PlayerName
+	GoalIdx  int
+	Goal     Goal
+	Photo    DisplayPhoto
+	Votes    int  // only once the game has ended
+	Winner   bool // only once the game has ended
+	VotedFor bool // whether the viewer voted for this photo
+	CanVote  bool
+}
+
+// galleryEntry is a submitted photo which the viewer may see.
+type galleryEntry struct {
+	player  PlayerName
+	goalIdx int
+	x, y    int
+	photo   Photo
+}
+
+// visibleSubmissions returns all submitted photos (see [BingoSpace.Hero]) the viewer (nil if not signed in) may see.
+func (gs *GameState) visibleSubmissions(viewer *PlayerName) []galleryEntry {
+	var res []galleryEntry
+	for name, ps := range gs.Players {
+		for x := range 5 {
+			for y := range 5 {
+				space := ps.Board.get(x, y)
+				hero := space.photo(space.Hero)
+				if hero == nil || space.GoalIdx == freeGoalIdx {
+					continue
+				}
+				if allowed, _ := gs.imageAccess(viewer, hero.Key); !allowed {
+					continue
+				}
+				res = append(res, galleryEntry{player: name, goalIdx: space.GoalIdx, x: x, y: y, photo: *hero})
+			}
+		}
+	}
+	return res
+}
+
+func goalGalleryPath(goalIdx int) string {
+	return "/gallery/goals/" + url.PathEscape(strconv.Itoa(goalIdx))
+}
+
+func playerGalleryPath(player PlayerName) string {
+	return "/gallery/players/" + url.PathEscape(string(player))
+}
+
+// galleryIndex lists all goals and players which have visible photos.
+func (gs *GameState) galleryIndex(viewer *PlayerName) GalleryData {
+	res := GalleryData{BaseURL: basePath, Title: "Gallery", Phase: gs.Settings.Phase}
+	goalCounts := map[int]int{}
+	playerCounts := map[PlayerName]int{}
+	for _, e := range gs.visibleSubmissions(viewer) {
+		goalCounts[e.goalIdx]++
+		playerCounts[e.player]++
+	}
+	for i, goal := range options {
+		if n := goalCounts[i]; n > 0 {
+			res.Goals = append(res.Goals, GalleryLink{Name: goal.Name, Path: goalGalleryPath(i), Count: n})
+		}
+	}
+	for name, n := range playerCounts {
+		res.Players = append(res.Players, GalleryLink{Name: string(name), Path: playerGalleryPath(name), Count: n})
+	}
+	slices.SortFunc(res.Players, func(a, b GalleryLink) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	if gs.Settings.Phase == PhaseEnded {
+		results := gs.voteResults()
+		res.Overall = results.Overall
+		for goalIdx := range options {
+			for _, key := range results.GoalWinners[goalIdx] {
+				loc, ok := gs.locatePhoto(key)
+				if !ok {
+					continue
+				}
+				if allowed, _ := gs.imageAccess(viewer, key); allowed {
+					entry := galleryEntry{player: loc.Player, goalIdx: loc.GoalIdx, x: loc.X, y: loc.Y, photo: loc.Photo}
+					res.Awards = append(res.Awards, gs.displayGalleryEntry(viewer, &results, entry))
+				}
+			}
+		}
+	}
+	return res
+}
+
+// goalGallery lists the visible submissions for one goal, ordered by player.
+func (gs *GameState) goalGallery(viewer *PlayerName, goalIdx int, page int) GalleryData {
+	entries := slices.DeleteFunc(gs.visibleSubmissions(viewer), func(e galleryEntry) bool {
+		return e.goalIdx != goalIdx
+	})
+	slices.SortFunc(entries, func(a, b galleryEntry) int {
+		return strings.Compare(string(a.player), string(b.player))
+	})
+	return gs.paginateGallery(viewer, options[goalIdx].Name, entries, page)
+}
+
+// playerGallery lists the visible submissions of one player, ordered by their position on the board.
+func (gs *GameState) playerGallery(viewer *PlayerName, player PlayerName, page int) GalleryData {
+	entries := slices.DeleteFunc(gs.visibleSubmissions(viewer), func(e galleryEntry) bool {
+		return e.player != player
+	})
+	slices.SortFunc(entries, func(a, b galleryEntry) int {
+		if a.y != b.y {
+			return a.y - b.y
+		}
+		return a.x - b.x
+	})
+	return gs.paginateGallery(viewer, string(player), entries, page)
+}
+
+func (gs *GameState) paginateGallery(viewer *PlayerName, title string, entries []galleryEntry, page int) GalleryData {
+	res := GalleryData{
+		BaseURL:   basePath,
+		Title:     title,
+		Phase:     gs.Settings.Phase,
+		PageCount: max(1, (len(entries)+galleryPageSize-1)/galleryPageSize),
+	}
+	res.Page = min(max(page, 1), res.PageCount)
+	start := (res.Page - 1) * galleryPageSize
+	var results VoteResults
+	if gs.Settings.Phase == PhaseEnded {
+		results = gs.voteResults()
+	}
+	for _, e := range entries[start:min(start+galleryPageSize, len(entries))] {
+		res.Entries = append(res.Entries, gs.displayGalleryEntry(viewer, &results, e))
+	}
+	return res
+}
+
+// displayGalleryEntry converts an entry for template rendering.
+// The results are only used once the game has ended.
+func (gs *GameState) displayGalleryEntry(viewer *PlayerName, results *VoteResults, e galleryEntry) GalleryEntry {
+	res := GalleryEntry{
+		Player:  e.player,
+		GoalIdx: e.goalIdx,
+		Goal:    options[e.goalIdx],
+		Photo:   e.photo.display(),
+	}
+	if viewer != nil {
+		res.VotedFor = gs.Votes[*viewer][e.goalIdx].Photo == e.photo.Key
+		res.CanVote = gs.Settings.Phase == PhaseVoting && *viewer != e.player
+	}
+	if gs.Settings.Phase == PhaseEnded {
+		res.Votes = results.Counts[e.photo.Key]
+		res.Winner = slices.Contains(results.GoalWinners[e.goalIdx], e.photo.Key)
+	}
+	return res
+}
@@ -1,18 +1,123 @@
 package main
 
-import "github.com/mrwonko/photo-bingo/muxval"
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrwonko/photo-bingo/muxval"
+)
 
 type GameState struct {
-	Players map[PlayerName]PlayerState
+	// format version of the persisted state, see [stateMigrations]
+	Version  int `json:",omitempty"`
+	Players  map[PlayerName]PlayerState
+	Settings GameSettings
+	// each voter's vote per goal, indexed by [options] index
+	Votes map[PlayerName]map[int]Vote `json:",omitempty"`
+	// by [Photo.Key]
+	Comments      map[string][]Comment             `json:",omitempty"`
+	Reactions     map[string]map[PlayerName]string `json:",omitempty"`
+	Notifications map[PlayerName][]Notification    `json:",omitempty"`
+	// images which are no longer referenced, and since when, see [collectGarbage]
+	DiscardedImages map[string]time.Time `json:",omitempty"`
+	// only ever appended to, see [cloneGameState]
+	AuditLog []AuditEntry `json:",omitempty"`
 }
 
-var gameState muxval.MuxVal[GameState]
+// page renders and saving work with a [muxval.MuxVal.Snapshot], so they don't hold up changes
+var gameState = muxval.MuxVal[GameState]{Clone: cloneGameState}
+
+// cloneGameState is [muxval.DeepCopy], except that the ever growing AuditLog is shared instead of copied.
+// Its entries are never modified, and appending to one copy only writes past the end of the others,
+// so they can't tell. This requires that appends only happen under the lock, which rules out appending to snapshots.
+func cloneGameState(gs GameState) GameState {
+	auditLog := gs.AuditLog
+	gs.AuditLog = nil
+	res := muxval.DeepCopy(gs)
+	res.AuditLog = auditLog
+	return res
+}
 
 type PlayerState struct {
-	Password InsecurePlaintextPassword
-	Approved bool
-	Board    BingoBoard
+	Password  InsecurePlaintextPassword
+	Approved  bool
+	Moderator bool   `json:",omitempty"`
+	Team      string `json:",omitempty"` // empty = no team
+	// IDs of the browsers this player signed up or voted from, see [deviceID]
+	Devices []string `json:",omitempty"`
+	// suspended players can no longer sign in
+	Suspended bool `json:",omitempty"`
+	Board     BingoBoard
+}
+
+type GameSettings struct {
+	Phase           GamePhase       `json:",omitempty"`
+	ImageVisibility ImageVisibility `json:",omitempty"`
+	// once the gallery is published, all images are visible to everyone, even without signing up
+	GalleryPublished bool `json:",omitempty"`
+	// whether near-duplicate uploads are rejected, rather than just flagged for moderators
+	BlockDuplicates   bool             `json:",omitempty"`
+	CommentsDisabled  bool             `json:",omitempty"`
+	ReactionsDisabled bool             `json:",omitempty"`
+	Completion        CompletionPolicy `json:",omitempty"`
+	Verification      VerificationMode `json:",omitempty"`
+	// for [VerifyPeers], at least 1
+	RequiredApprovals int `json:",omitempty"`
+	// photos taken outside of this window are flagged for moderators, zero = unbounded
+	Start, End time.Time
+}
+
+// GamePhase determines what players can do: first they fill their boards, then they vote on the best photos.
+type GamePhase string
+
+const (
+	PhasePlaying GamePhase = ""
+	PhaseVoting  GamePhase = "voting"
+	PhaseEnded   GamePhase = "ended"
+)
+
+func parseGamePhase(s string) (GamePhase, error) {
+	switch p := GamePhase(s); p {
+	case PhasePlaying, PhaseVoting, PhaseEnded:
+		return p, nil
+	case "playing":
+		return PhasePlaying, nil
+	default:
+		return "", fmt.Errorf("invalid game phase %q, must be one of playing, voting, ended", s)
+	}
+}
+
+// ImageVisibility determines who may see a player's images before the gallery is published.
+// The owner and moderators can always see them.
+type ImageVisibility string
+
+const (
+	VisibilityOwner   ImageVisibility = ""
+	VisibilityTeam    ImageVisibility = "team"
+	VisibilityPlayers ImageVisibility = "players"
+)
+
+func parseImageVisibility(s string) (ImageVisibility, error) {
+	switch v := ImageVisibility(s); v {
+	case VisibilityOwner, VisibilityTeam, VisibilityPlayers:
+		return v, nil
+	case "owner":
+		return VisibilityOwner, nil
+	default:
+		return "", fmt.Errorf("invalid image visibility %q, must be one of owner, team, players", s)
+	}
 }
 
 type PlayerName string
 type InsecurePlaintextPassword string
+
+// discardImage marks an image which is no longer referenced for deletion once the grace period is over.
+func (gs *GameState) discardImage(key string, now time.Time) {
+	if key == "" {
+		return
+	}
+	if gs.DiscardedImages == nil {
+		gs.DiscardedImages = map[string]time.Time{}
+	}
+	gs.DiscardedImages[key] = now
+}
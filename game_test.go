@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestCloneGameStateSharesAuditLog(t *testing.T) {
+	orig := testGameState()
+	c := cloneGameState(orig)
+	if &c.AuditLog[0] != &orig.AuditLog[0] {
+		t.Error("audit log was copied")
+	}
+	c.audit(AuditEntry{Action: "clone"})
+	alice := c.Players["alice"]
+	alice.Board.get(1, 2).Photos[0].Caption = "changed"
+	if len(orig.AuditLog) != 1 {
+		t.Errorf("appending to the clone's audit log changed the original to %d entries", len(orig.AuditLog))
+	}
+	origAlice := orig.Players["alice"]
+	if got := origAlice.Board.get(1, 2).Photos[0].Caption; got != "first" {
+		t.Errorf("photos shared with the clone, caption = %q", got)
+	}
+}
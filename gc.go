@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// ImageReport lists inconsistencies between the game state and the stored images.
+type ImageReport struct {
+	Orphaned []string // stored, but not referenced by any board
+	Missing  []string // referenced by a board, but not stored
+	Deleted  []string // orphans whose grace period is over, deleted unless this was a dry run
+}
+
+// referencedImages returns the keys of all images on all boards, plus their derivatives.
+func (gs *GameState) referencedImages() (originals []string, all map[string]bool) {
+	all = map[string]bool{}
+	for _, ps := range gs.Players {
+		for x := range 5 {
+			for y := range 5 {
+				for _, photo := range ps.Board.get(x, y).Photos {
+					key := photo.Key
+					originals = append(originals, key)
+					all[key] = true
+					all[derivativeKey(key, thumbnailVariant)] = true
+					for _, width := range imageVariantWidths {
+						all[derivativeKey(key, widthVariant(width))] = true
+					}
+				}
+			}
+		}
+	}
+	return originals, all
+}
+
+// collectGarbage deletes stored images which have not been referenced by the game state for [imageGCGracePeriod].
+// Orphans which are not yet known to be discarded are recorded, starting their grace period.
+// If dryRun is set, nothing is changed and only the report is returned.
+func collectGarbage(ctx context.Context, now time.Time, dryRun bool) (ImageReport, error) {
+	var report ImageReport
+	stored, err := blobs.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("listing stored images: %w", err)
+	}
+	var (
+		originals  []string
+		referenced map[string]bool
+		discarded  map[string]time.Time
+	)
+	gameState.Read(func(gs GameState) {
+		originals, referenced = gs.referencedImages()
+		discarded = make(map[string]time.Time, len(gs.DiscardedImages))
+		for k, v := range gs.DiscardedImages {
+			discarded[k] = v
+		}
+	})
+
+	isStored := make(map[string]bool, len(stored))
+	for _, key := range stored {
+		isStored[key] = true
+	}
+	for _, key := range originals {
+		if !isStored[key] {
+			report.Missing = append(report.Missing, key)
+		}
+	}
+
+	newlyDiscarded := map[string]time.Time{}
+	var errs []error
+	for _, key := range stored {
+		if referenced[key] {
+			continue
+		}
+		report.Orphaned = append(report.Orphaned, key)
+		since, ok := discarded[key]
+		if original, _, isDerivative := parseDerivativeKey(key); !ok && isDerivative {
+			since, ok = discarded[original]
+		}
+		if !ok {
+			newlyDiscarded[key] = now
+			continue
+		}
+		if now.Sub(since) < imageGCGracePeriod {
+			continue
+		}
+		report.Deleted = append(report.Deleted, key)
+		if dryRun {
+			continue
+		}
+		if err := blobs.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %q: %w", key, err))
+		}
+	}
+	if dryRun {
+		return report, errors.Join(errs...)
+	}
+
+	gameState.Modify(func(gs GameState) GameState {
+		for key := range gs.DiscardedImages {
+			// forget about images which are gone or (for some reason) referenced again
+			if !isStored[key] || slices.Contains(report.Deleted, key) || referenced[key] {
+				delete(gs.DiscardedImages, key)
+			}
+		}
+		for key, since := range newlyDiscarded {
+			gs.discardImage(key, since)
+		}
+		for _, key := range report.Deleted {
+			delete(gs.Comments, key)
+			delete(gs.Reactions, key)
+		}
+		return gs
+	})
+	return report, errors.Join(errs...)
+}
+
+// runGarbageCollection periodically calls [collectGarbage] until the context is canceled.
+func runGarbageCollection(ctx context.Context) {
+	ticker := time.NewTicker(imageGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report, err := collectGarbage(ctx, time.Now(), false)
+		if err != nil {
+			log.Printf("image garbage collection failed: %s", err)
+		}
+		logf("image garbage collection: %d orphaned, %d deleted, %d missing", len(report.Orphaned), len(report.Deleted), len(report.Missing))
+	}
+}
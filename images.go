@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gen2brain/heic"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// storedImageQuality is the JPEG quality used when re-encoding non-JPEG uploads.
+const storedImageQuality = 90
+
+func init() {
+	// the heic package only registers the "heic" brand, but phones also produce these
+	for _, brand := range []string{"heix", "hevc", "hevx", "mif1", "msf1"} {
+		image.RegisterFormat("heic", "????ftyp"+brand, heic.Decode, heic.DecodeConfig)
+	}
+}
+
+// normalizeImage sniffs the format of an uploaded image from its contents
+// (ignoring whatever Content-Type the client claimed) and returns it as a JPEG.
+// JPEGs are passed through unchanged to preserve their metadata,
+// everything else is decoded and re-encoded.
+func normalizeImage(data []byte) ([]byte, error) {
+	// the header is checked first, since a small file can claim huge dimensions and decoding it would exhaust memory
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, errors.New("upload is not a supported image (JPEG, PNG, WebP, GIF or HEIC)")
+		}
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large, limit %d megapixels", config.Width, config.Height, maxImagePixels/1_000_000)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	if format == "jpeg" {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: storedImageQuality})
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s image as JPEG: %w", format, err)
+	}
+	logf("converted %s upload to JPEG", format)
+	return buf.Bytes(), nil
+}
+
+const thumbnailVariant = "thumb"
+
+// ImageVariant is a resized copy of an uploaded image, for use in srcset.
+type ImageVariant struct {
+	Path  string // relative to [basePath]
+	Width int
+}
+
+// imageVariants lists the resized variants of the given original image, which may not have been generated yet.
+// Variants at least as wide as the original don't exist, the original itself takes their place.
+// If the width of the original is unknown, all variants are listed.
+func imageVariants(original string, originalWidth int) []ImageVariant {
+	var res []ImageVariant
+	for _, width := range imageVariantWidths {
+		if originalWidth > 0 && width >= originalWidth {
+			res = append(res, ImageVariant{Path: imageURLPath(original), Width: originalWidth})
+			break
+		}
+		res = append(res, ImageVariant{
+			Path:  imageURLPath(derivativeKey(original, widthVariant(width))),
+			Width: width,
+		})
+	}
+	return res
+}
+
+// orientedWidth returns the width of a JPEG as displayed, after applying its EXIF orientation, or zero if unknown.
+func orientedWidth(data []byte) int {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	if orientation := jpegOrientation(data); orientation >= 5 && orientation <= 8 {
+		// rotated by 90°
+		return config.Height
+	}
+	return config.Width
+}
+
+// imageURLPath returns the path (relative to [basePath]) under which the image with the given blob key is served.
+func imageURLPath(key string) string {
+	return imagePath + "/" + url.PathEscape(key)
+}
+
+func widthVariant(width int) string {
+	return "w" + strconv.Itoa(width)
+}
+
+// derivativeKey returns the blob key of a derived image, like "foo.thumb.jpg" for "foo.jpg".
+func derivativeKey(original string, variant string) string {
+	return strings.TrimSuffix(original, ".jpg") + "." + variant + ".jpg"
+}
+
+// parseDerivativeKey is the inverse of [derivativeKey].
+// It returns ok=false if the key does not refer to a known variant.
+func parseDerivativeKey(key string) (original string, variant string, ok bool) {
+	base, found := strings.CutSuffix(key, ".jpg")
+	if !found {
+		return "", "", false
+	}
+	dot := strings.LastIndexByte(base, '.')
+	if dot < 0 {
+		return "", "", false
+	}
+	original, variant = base[:dot]+".jpg", base[dot+1:]
+	if variant == thumbnailVariant {
+		return original, variant, true
+	}
+	for _, width := range imageVariantWidths {
+		if variant == widthVariant(width) {
+			return original, variant, true
+		}
+	}
+	return "", "", false
+}
+
+// generateDerivatives writes the thumbnail and the resized variants narrower than the given original image.
+// If only is non-empty, only these variants are generated, even if they are as wide as the original,
+// as photos whose width is unknown still link to them.
+func generateDerivatives(ctx context.Context, original string, only ...string) error {
+	data, err := blobs.Get(ctx, original)
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", original, err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decoding %q: %w", original, err)
+	}
+	img = applyOrientation(img, jpegOrientation(data))
+	wanted := func(variant string) bool {
+		return len(only) == 0 || slices.Contains(only, variant)
+	}
+	var errs []error
+	if wanted(thumbnailVariant) {
+		errs = append(errs, writeDerivative(ctx, derivativeKey(original, thumbnailVariant), thumbnail(img)))
+	}
+	for _, width := range imageVariantWidths {
+		if len(only) == 0 && width >= img.Bounds().Dx() {
+			break
+		}
+		if variant := widthVariant(width); wanted(variant) {
+			errs = append(errs, writeDerivative(ctx, derivativeKey(original, variant), resizeToWidth(img, width)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeDerivative(ctx context.Context, key string, img image.Image) error {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: storedImageQuality})
+	if err != nil {
+		return fmt.Errorf("encoding %q: %w", key, err)
+	}
+	err = blobs.Put(ctx, key, buf.Bytes(), "image/jpeg")
+	if err != nil {
+		return fmt.Errorf("storing %q: %w", key, err)
+	}
+	return nil
+}
+
+// thumbnail scales the center square of an image to [thumbnailSize].
+func thumbnail(img image.Image) image.Image {
+	b := img.Bounds()
+	edge := min(b.Dx(), b.Dy())
+	src := image.Rect(0, 0, edge, edge).Add(b.Min).Add(image.Pt((b.Dx()-edge)/2, (b.Dy()-edge)/2))
+	dst := image.NewRGBA(image.Rect(0, 0, thumbnailSize, thumbnailSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+// resizeToWidth scales an image down to the given width, preserving its aspect ratio.
+// Smaller images are not scaled up.
+func resizeToWidth(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+	height := max(1, b.Dy()*width/b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"time"
+)
+
+// The game state is persisted as a snapshot in [latestStatePath] plus a journal in [journalPath]
+// of the changes made since the snapshot was written, so saving doesn't rewrite the whole state.
+// Once the journal has grown to [maxJournalRecords], it is compacted into a new snapshot.
+
+// journalRecord is a line of the journal, holding the changes between two saves.
+type journalRecord struct {
+	Seq     uint64        `json:"seq"`
+	At      time.Time     `json:"at"`
+	Changes []stateChange `json:"changes"`
+}
+
+// stateChange replaces a top-level field of [GameState], a single entry of a map field,
+// or the elements of a slice field from an index on (which only ever grow, like [GameState.AuditLog]).
+// Changes are absolute values, so replaying records which are already part of the snapshot does no harm.
+type stateChange struct {
+	Field  string          `json:"field"`
+	Key    string          `json:"key,omitempty"`    // for map fields
+	Index  int             `json:"index,omitempty"`  // for slice fields
+	Value  json.RawMessage `json:"value,omitempty"`  // for slice fields, an array of the elements from Index on
+	Delete bool            `json:"delete,omitempty"` // for map fields, remove the entry
+}
+
+// apply performs a change read from the journal.
+func (gs *GameState) apply(c stateChange) error {
+	field := reflect.ValueOf(gs).Elem().FieldByName(c.Field)
+	if !field.IsValid() {
+		return fmt.Errorf("unknown field %q", c.Field)
+	}
+	switch field.Kind() {
+	case reflect.Map:
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(field.Type()))
+		}
+		key := reflect.ValueOf(c.Key).Convert(field.Type().Key())
+		if c.Delete {
+			field.SetMapIndex(key, reflect.Value{})
+			return nil
+		}
+		value := reflect.New(field.Type().Elem())
+		if err := json.Unmarshal(c.Value, value.Interface()); err != nil {
+			return fmt.Errorf("%s[%q]: %w", c.Field, c.Key, err)
+		}
+		field.SetMapIndex(key, value.Elem())
+	case reflect.Slice:
+		if c.Index > field.Len() {
+			return fmt.Errorf("%s: index %d beyond length %d", c.Field, c.Index, field.Len())
+		}
+		tail := reflect.New(field.Type())
+		if err := json.Unmarshal(c.Value, tail.Interface()); err != nil {
+			return fmt.Errorf("%s[%d:]: %w", c.Field, c.Index, err)
+		}
+		field.Set(reflect.AppendSlice(field.Slice(0, c.Index), tail.Elem()))
+	default:
+		value := reflect.New(field.Type())
+		if err := json.Unmarshal(c.Value, value.Interface()); err != nil {
+			return fmt.Errorf("%s: %w", c.Field, err)
+		}
+		field.Set(value.Elem())
+	}
+	return nil
+}
+
+// stateShadow is the game state as it was last persisted, to find what changed.
+// It keeps the [muxval.MuxVal.Snapshot] it was made from, which is never modified.
+type stateShadow struct {
+	state *GameState // nil if nothing was persisted yet
+}
+
+// diff returns the changes since the state the shadow was made from, and the shadow of the given state,
+// which must not be modified afterwards. Only the changed parts are marshaled; finding them is a comparison
+// with the previous state, which unlike marshaling doesn't allocate.
+// The shadow itself is left alone, so it remains valid if persisting the changes fails.
+func (sh stateShadow) diff(gs *GameState) ([]stateChange, stateShadow, error) {
+	var changes []stateChange
+	v := reflect.ValueOf(gs).Elem()
+	var prev reflect.Value // invalid if nothing was persisted yet
+	if sh.state != nil {
+		prev = reflect.ValueOf(sh.state).Elem()
+	}
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Name
+		field := v.Field(i)
+		var old reflect.Value
+		if prev.IsValid() {
+			old = prev.Field(i)
+		}
+		switch field.Kind() {
+		case reflect.Map:
+			for iter := field.MapRange(); iter.Next(); {
+				if old.IsValid() {
+					if prevValue := old.MapIndex(iter.Key()); prevValue.IsValid() && reflect.DeepEqual(prevValue.Interface(), iter.Value().Interface()) {
+						continue
+					}
+				}
+				key := iter.Key().String()
+				value, err := json.Marshal(iter.Value().Interface())
+				if err != nil {
+					return nil, sh, fmt.Errorf("marshaling %s[%q]: %w", name, key, err)
+				}
+				changes = append(changes, stateChange{Field: name, Key: key, Value: value})
+			}
+			if old.IsValid() {
+				for iter := old.MapRange(); iter.Next(); {
+					if !field.MapIndex(iter.Key()).IsValid() {
+						changes = append(changes, stateChange{Field: name, Key: iter.Key().String(), Delete: true})
+					}
+				}
+			}
+		case reflect.Slice:
+			from := 0
+			if old.IsValid() {
+				from = old.Len()
+				if from == field.Len() {
+					continue
+				}
+			}
+			if from > field.Len() {
+				// shrunk after all, replace it entirely
+				from = 0
+			}
+			tail, err := json.Marshal(field.Slice(from, field.Len()).Interface())
+			if err != nil {
+				return nil, sh, fmt.Errorf("marshaling %s: %w", name, err)
+			}
+			changes = append(changes, stateChange{Field: name, Index: from, Value: tail})
+		default:
+			if old.IsValid() && reflect.DeepEqual(old.Interface(), field.Interface()) {
+				continue
+			}
+			value, err := json.Marshal(field.Interface())
+			if err != nil {
+				return nil, sh, fmt.Errorf("marshaling %s: %w", name, err)
+			}
+			changes = append(changes, stateChange{Field: name, Value: value})
+		}
+	}
+	return changes, stateShadow{state: gs}, nil
+}
+
+// stateJournal appends changes of the game state to [journalPath].
+type stateJournal struct {
+	file    *os.File
+	seq     uint64
+	records int   // since the last snapshot
+	size    int64 // of the valid part of the file
+	// when the last snapshot was written, see [snapshotInterval]
+	snapshotAt time.Time
+}
+
+// replay applies the records in [journalPath] to the given state.
+// A truncated or garbled final record is the result of a crash while writing it, so it is dropped;
+// any other invalid record is an error, since skipping it would silently lose changes.
+func (j *stateJournal) replay(gs *GameState) error {
+	data, err := os.ReadFile(journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading journal %q: %w", journalPath, err)
+	}
+	valid := 0 // length of the valid prefix
+	for valid < len(data) {
+		end := bytes.IndexByte(data[valid:], '\n')
+		var record journalRecord
+		if end < 0 || json.Unmarshal(data[valid:valid+end], &record) != nil {
+			if end >= 0 && valid+end+1 < len(data) {
+				return fmt.Errorf("journal %q: invalid record at offset %d", journalPath, valid)
+			}
+			log.Printf("dropping incomplete final record of journal %q at offset %d", journalPath, valid)
+			if err := os.Truncate(journalPath, int64(valid)); err != nil {
+				return fmt.Errorf("truncating journal %q: %w", journalPath, err)
+			}
+			break
+		}
+		for _, c := range record.Changes {
+			if err := gs.apply(c); err != nil {
+				return fmt.Errorf("journal %q, record %d: %w", journalPath, record.Seq, err)
+			}
+		}
+		j.seq = record.Seq
+		j.records++
+		valid += end + 1
+	}
+	if j.records > 0 {
+		logf("replayed %d journal records from %q", j.records, journalPath)
+	}
+	return nil
+}
+
+// quarantine moves [journalPath] aside for manual recovery, instead of replaying it on top of a backup
+// it doesn't belong to. Applying its changes to an older state could corrupt it or fail halfway.
+func (j *stateJournal) quarantine(now time.Time) error {
+	path := journalPath + ".quarantined-" + now.UTC().Format(snapshotTimeFormat)
+	if err := os.Rename(journalPath, path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("quarantining journal %q: %w", journalPath, err)
+	}
+	log.Printf("WARNING: not replaying journal %q on top of a backup, moved it to %q; its changes are lost unless recovered by hand", journalPath, path)
+	return nil
+}
+
+// open starts appending to [journalPath].
+func (j *stateJournal) open() error {
+	f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("opening journal %q: %w", journalPath, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening journal %q: %w", journalPath, err)
+	}
+	j.file = f
+	j.size = info.Size()
+	return nil
+}
+
+// append writes a record of the given changes and waits for it to reach the disk.
+func (j *stateJournal) append(changes []stateChange, now time.Time) error {
+	if j.file == nil {
+		return errors.New("journal not opened")
+	}
+	line, err := json.Marshal(journalRecord{Seq: j.seq + 1, At: now, Changes: changes})
+	if err != nil {
+		return fmt.Errorf("marshaling journal record: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := j.file.Write(line); err != nil {
+		// don't leave a partial record in front of the next one
+		if err := j.file.Truncate(j.size); err != nil {
+			log.Printf("failed to remove partial record from journal %q: %s", journalPath, err)
+		}
+		return fmt.Errorf("writing journal %q: %w", journalPath, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("syncing journal %q: %w", journalPath, err)
+	}
+	j.seq++
+	j.records++
+	j.size += int64(len(line))
+	return nil
+}
+
+// reset empties the journal once its records are part of a snapshot.
+func (j *stateJournal) reset() error {
+	if err := os.Truncate(journalPath, 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("truncating journal %q: %w", journalPath, err)
+	}
+	j.records = 0
+	j.size = 0
+	return nil
+}
+
+func (j *stateJournal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestJournal journals three changes to the game without a snapshot,
+// returning the lines of the journal and the state after each of them.
+func writeTestJournal(t *testing.T) (lines [][]byte, states []string) {
+	t.Helper()
+	s := &JSONFileStore{}
+	if _, err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	gs := testGameState()
+	var shadow stateShadow
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for step := range 3 {
+		switch step {
+		case 1:
+			gs.Players["carol"] = PlayerState{Password: "c"}
+		case 2:
+			delete(gs.Players, "bob")
+		}
+		changes, next := diffTestState(t, shadow, gs)
+		if err := s.Save(changes, nil, at.Add(time.Duration(step)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		shadow = next
+		states = append(states, mustJSON(t, gs))
+	}
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) != 4 || len(lines[3]) != 0 {
+		t.Fatalf("journal has %d lines, want 3 records", len(lines)-1)
+	}
+	return lines[:3], states
+}
+
+func TestJournalReplay(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		last    func(line []byte) []byte // replaces the final record
+		records int                      // expected to be replayed
+	}{
+		{"complete", func(line []byte) []byte { return line }, 3},
+		{"cut off final record", func(line []byte) []byte { return line[:len(line)/2] }, 2},
+		{"garbled final record", func([]byte) []byte { return []byte("{\"seq\":3,\"chan\x00ges\n") }, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t)
+			lines, states := writeTestJournal(t)
+			data := append(bytes.Join(lines[:2], nil), tc.last(lines[2])...)
+			if err := os.WriteFile(journalPath, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			s := &JSONFileStore{}
+			got, err := s.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if s.journal.records != tc.records {
+				t.Errorf("replayed %d records, want %d", s.journal.records, tc.records)
+			}
+			if g, want := mustJSON(t, got), states[tc.records-1]; g != want {
+				t.Errorf("replayed state differs\ngot:  %s\nwant: %s", g, want)
+			}
+		})
+	}
+}
+
+func TestJournalReplayRejectsGarbledRecordInTheMiddle(t *testing.T) {
+	inTempDir(t)
+	lines, _ := writeTestJournal(t)
+	lines[1] = []byte("not a record\n")
+	if err := os.WriteFile(journalPath, bytes.Join(lines, nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &JSONFileStore{}
+	_, err := s.Load()
+	if err == nil || !strings.Contains(err.Error(), "invalid record") {
+		t.Errorf("replaying a journal with a garbled record in the middle: got error %v, want it to be rejected", err)
+	}
+	s.Close()
+}
+
+func TestJournalAppendAfterDroppingFinalRecord(t *testing.T) {
+	inTempDir(t)
+	lines, _ := writeTestJournal(t)
+	cut := append(bytes.Join(lines[:2], nil), lines[2][:len(lines[2])/2]...)
+	if err := os.WriteFile(journalPath, cut, 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &JSONFileStore{}
+	gs, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, shadow := diffTestState(t, stateShadow{}, gs)
+	gs.Players["dave"] = PlayerState{Password: "d"}
+	changes, _ := diffTestState(t, shadow, gs)
+	if err := s.Save(changes, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	for i, line := range records {
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("record %d is invalid after appending: %s\n%s", i, err, data)
+		}
+		if record.Seq != uint64(i+1) {
+			t.Errorf("record %d has sequence number %d, want %d", i, record.Seq, i+1)
+		}
+	}
+	if len(records) != 3 {
+		t.Errorf("journal has %d records, want 3", len(records))
+	}
+	s = &JSONFileStore{}
+	got, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if g, w := mustJSON(t, got), mustJSON(t, gs); g != w {
+		t.Errorf("replayed state differs\ngot:  %s\nwant: %s", g, w)
+	}
+}
+
+func TestStateShadowDiffsOnlyChangedEntries(t *testing.T) {
+	gs := testGameState()
+	_, shadow := diffTestState(t, stateShadow{}, gs)
+	if changes, _ := diffTestState(t, shadow, gs); len(changes) != 0 {
+		t.Errorf("unchanged state has changes %+v", changes)
+	}
+
+	alice := gs.Players["alice"]
+	alice.Board.get(1, 2).Photos[0].Caption = "changed"
+	gs.Players["alice"] = alice
+	delete(gs.Comments, "p1.jpg")
+	gs.AuditLog = append(gs.AuditLog, AuditEntry{Action: "caption"})
+	gs.Settings.Phase = PhaseVoting
+	changes, _ := diffTestState(t, shadow, gs)
+	var got []string
+	for _, c := range changes {
+		got = append(got, fmt.Sprintf("%s[%s%d] delete=%t", c.Field, c.Key, c.Index, c.Delete))
+	}
+	want := []string{"Players[alice0] delete=false", "Settings[0] delete=false", "Comments[p1.jpg0] delete=true", "AuditLog[1] delete=false"}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+type LeaderboardData struct {
+	BaseURL string
+	User    PlayerName
+	Phase   GamePhase
+	Rows    []LeaderboardRow
+	Overall []PlayerName // most votes overall, once the game has ended
+}
+
+type LeaderboardRow struct {
+	Rank      int // players with equal scores share a rank
+	Player    PlayerName
+	Score     int // number of bingos
+	Completed int // number of completed spaces, as a tie breaker
+	GoalsWon  int // only once the game has ended
+	Votes     int // only once the game has ended
+}
+
+func (board *BingoBoard) completedSpaces(settings GameSettings) int {
+	res := 0
+	for x := range 5 {
+		for y := range 5 {
+			if board.get(x, y).counts(settings) {
+				res++
+			}
+		}
+	}
+	return res
+}
+
+func (gs *GameState) leaderboard(viewer PlayerName) LeaderboardData {
+	res := LeaderboardData{
+		BaseURL: basePath,
+		User:    viewer,
+		Phase:   gs.Settings.Phase,
+	}
+	var results VoteResults
+	if gs.Settings.Phase == PhaseEnded {
+		results = gs.voteResults()
+		res.Overall = results.Overall
+	}
+	for name, ps := range gs.Players {
+		row := LeaderboardRow{
+			Player:    name,
+			Score:     ps.Board.score(gs.Settings),
+			Completed: ps.Board.completedSpaces(gs.Settings),
+		}
+		if gs.Settings.Phase == PhaseEnded {
+			row.GoalsWon = results.goalsWon(gs, name)
+			for x := range 5 {
+				for y := range 5 {
+					row.Votes += results.Counts[ps.Board.get(x, y).Hero]
+				}
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	slices.SortFunc(res.Rows, func(a, b LeaderboardRow) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			cmp.Compare(b.Completed, a.Completed),
+			cmp.Compare(a.Player, b.Player),
+		)
+	})
+	for i := range res.Rows {
+		row := &res.Rows[i]
+		row.Rank = i + 1
+		if i > 0 {
+			if prev := res.Rows[i-1]; prev.Score == row.Score && prev.Completed == row.Completed {
+				row.Rank = prev.Rank
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LiveFragment is a part of a page which is updated live: elements with a data-live attribute naming the template
+// get their content replaced whenever the server sends a new rendering of it, see live.html.
+type LiveFragment struct {
+	Template *template.Template
+	Data     func(gs *GameState, user PlayerName) any
+}
+
+// registerLiveUpdates adds the /events endpoint streaming the fragments, until the context is canceled.
+func registerLiveUpdates(mux *http.ServeMux, ctx context.Context, fragments []LiveFragment) {
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
+		user, err := checkAuth(r)
+		if err != nil || user == nil {
+			serveError(w, http.StatusUnauthorized, errors.Join(errors.New("not signed in"), err))
+			return
+		}
+		// only render what the page shows, e.g. ?fragments=board
+		selected, err := selectLiveFragments(fragments, r.FormValue("fragments"))
+		if err != nil {
+			serveError(w, http.StatusBadRequest, err)
+			return
+		}
+		serveLiveUpdates(ctx, w, r, *user, selected)
+	})
+}
+
+// selectLiveFragments returns the fragments named in a comma separated list, as a page requests those it shows.
+func selectLiveFragments(fragments []LiveFragment, names string) ([]LiveFragment, error) {
+	if names == "" {
+		return nil, errors.New("no live fragments requested")
+	}
+	var res []LiveFragment
+	for _, name := range strings.Split(names, ",") {
+		i := slices.IndexFunc(fragments, func(f LiveFragment) bool { return f.Template.Name() == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown live fragment %q", name)
+		}
+		if !slices.ContainsFunc(res, func(f LiveFragment) bool { return f.Template.Name() == name }) {
+			res = append(res, fragments[i])
+		}
+	}
+	return res, nil
+}
+
+// serveLiveUpdates streams the fragments as Server-Sent Events named after their template,
+// whenever the game state changes in a way that changes their rendering for the user.
+// It returns once the client disconnects, the user is suspended, or the context is canceled.
+func serveLiveUpdates(ctx context.Context, w http.ResponseWriter, r *http.Request, user PlayerName, fragments []LiveFragment) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		serveError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	changed := make(chan struct{}, 1)
+	unsubscribe := gameState.Subscribe(func(uint64) {
+		select {
+		case changed <- struct{}{}:
+		default:
+			// the next update includes this change, too
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+	sent := make(map[string]string, len(fragments)) // by template name
+	for {
+		gs := gameState.Snapshot()
+		if ps, ok := gs.Players[user]; !ok || ps.Suspended {
+			return
+		}
+		for _, f := range fragments {
+			var buf bytes.Buffer
+			if err := f.Template.Execute(&buf, f.Data(&gs, user)); err != nil {
+				log.Printf("failed to render live update %q: %s", f.Template.Name(), err)
+				return
+			}
+			name, html := f.Template.Name(), buf.String()
+			if sent[name] == html {
+				continue
+			}
+			if err := writeEvent(w, name, html); err != nil {
+				return
+			}
+			sent[name] = html
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event, whose data may span multiple lines.
+func writeEvent(w io.Writer, name, data string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", name)
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r", ""), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
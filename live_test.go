@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent returns the next Server-Sent Event, skipping keep-alive comments.
+func readEvent(t *testing.T, r *bufio.Reader) (name, data string, err error) {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", "", err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, strings.Join(lines, "\n"), nil
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestLiveUpdates(t *testing.T) {
+	gameState.Modify(func(GameState) GameState { return testGameState() })
+	t.Cleanup(func() { gameState.Modify(func(GameState) GameState { return GameState{} }) })
+	fragments := []LiveFragment{
+		{Template: template.Must(template.New("phase").Parse("{{.}}")), Data: func(gs *GameState, user PlayerName) any {
+			return cmp.Or(string(gs.Settings.Phase), "playing")
+		}},
+		{Template: template.Must(template.New("players").Parse("{{.}}")), Data: func(gs *GameState, user PlayerName) any {
+			return len(gs.Players)
+		}},
+	}
+	liveCtx, stopLive := context.WithCancel(context.Background())
+	defer stopLive()
+	mux := http.NewServeMux()
+	registerLiveUpdates(mux, liveCtx, fragments)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	srv.Config.RegisterOnShutdown(stopLive)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/events?fragments=phase", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(testAuthCookie(t, "alice"))
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := bufio.NewReader(resp.Body)
+	if name, data, err := readEvent(t, events); err != nil || name != "phase" || data != "playing" {
+		t.Fatalf("first event = %q %q, %v, want the phase only", name, data, err)
+	}
+
+	// the players fragment changes, too, but wasn't requested
+	gameState.Modify(func(gs GameState) GameState {
+		gs.Players["carol"] = PlayerState{Password: "c"}
+		gs.Settings.Phase = PhaseVoting
+		return gs
+	})
+	if name, data, err := readEvent(t, events); err != nil || name != "phase" || data != "voting" {
+		t.Fatalf("event after the change = %q %q, %v, want the new phase", name, data, err)
+	}
+
+	if err := srv.Config.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if name, data, err := readEvent(t, events); err != io.EOF {
+		t.Errorf("after shutting down got event %q %q, %v, want the stream to end", name, data, err)
+	}
+}
+
+func TestLiveUpdatesRejectUnknownFragments(t *testing.T) {
+	gameState.Modify(func(GameState) GameState { return testGameState() })
+	t.Cleanup(func() { gameState.Modify(func(GameState) GameState { return GameState{} }) })
+	mux := http.NewServeMux()
+	registerLiveUpdates(mux, context.Background(), nil)
+	for _, query := range []string{"", "?fragments=", "?fragments=board"} {
+		req := httptest.NewRequest(http.MethodGet, "/events"+query, nil)
+		req.AddCookie(testAuthCookie(t, "alice"))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("events%s = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events?fragments=board", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("events signed out = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
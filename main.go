@@ -4,17 +4,16 @@ import (
 	"bytes"
 	"context"
 	"embed"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"path"
 	"strconv"
 	"sync"
 	"time"
@@ -26,15 +25,22 @@ type SignupData struct {
 }
 
 type GameData struct {
-	BaseURL string
-	User    PlayerName
-	Board   DisplayBingoBoard
-	Score   int
+	BaseURL       string
+	User          PlayerName
+	Moderator     bool
+	Board         DisplayBingoBoard
+	Score         int
+	Verification  bool           // whether completed spaces need to be verified
+	Notifications []Notification // newest first
 }
 
 type SpaceData struct {
-	BaseURL string
-	Space   DisplayBingoSpace
+	BaseURL           string
+	Space             DisplayBingoSpace
+	CommentsDisabled  bool
+	ReactionsDisabled bool
+	Verification      bool // whether completed spaces need to be verified
+	PhotoRequired     bool // whether spaces can only be completed by uploading a photo
 }
 
 //go:embed templates
@@ -56,6 +62,9 @@ func main() {
 			}
 			return dict, nil
 		},
+		"add": func(a, b int) int {
+			return a + b
+		},
 	}).ParseFS(templateFS, "templates/*.html")
 	if err != nil {
 		log.Fatalf("Failed to parse templates: %s", err)
@@ -70,12 +79,22 @@ func main() {
 	signup := mustLookup("signup.html")
 	index := mustLookup("index.html")
 	space := mustLookup("space.html")
+	moderation := mustLookup("moderation.html")
+	gallery := mustLookup("gallery.html")
+	leaderboard := mustLookup("leaderboard.html")
+	photo := mustLookup("photo.html")
+	review := mustLookup("review.html")
+	audit := mustLookup("audit.html")
+	snapshots := mustLookup("snapshots.html")
+	// the parts of pages which are updated live, see live.html
+	liveFragments := []LiveFragment{
+		{Template: mustLookup("board"), Data: func(gs *GameState, user PlayerName) any { return gs.gameData(user) }},
+		{Template: mustLookup("leaderboard-table"), Data: func(gs *GameState, user PlayerName) any { return gs.leaderboard(user) }},
+	}
 
-	if _, err := os.Stat(imagePath); errors.Is(err, os.ErrNotExist) {
-		err = os.MkdirAll(imagePath, 0700)
-		if err != nil {
-			log.Fatalf("Failed to create image directory %q: %s", imagePath, err)
-		}
+	blobs, err = newBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up image storage: %s", err)
 	}
 
 	err = loadState()
@@ -83,144 +102,432 @@ func main() {
 		log.Fatalf("failed to load state: %s", err)
 	}
 
-	saveTrigger := make(chan struct{}, 32) // keep a buffer to try to avoid blocking on high traffic
+	if len(os.Args) > 1 {
+		err = runCommand(context.Background(), os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatalf("%s: %s", os.Args[1], err)
+		}
+		if err := store.Close(); err != nil {
+			log.Printf("failed to close state store: %s", err)
+		}
+		return
+	}
+
+	// handlers don't need to remember to save their changes
+	unsubscribeSaves := gameState.Subscribe(func(uint64) {
+		saves.request()
+	})
+	defer unsubscribeSaves()
+
+	// live updates never finish on their own, so they are ended when shutting down
+	liveCtx, stopLive := context.WithCancel(context.Background())
+	defer stopLive()
 
 	mux := http.NewServeMux()
 
-	fileServer := http.StripPrefix("/"+imagePath, http.FileServer(http.Dir(imagePath)))
+	mux.HandleFunc("GET /"+imagePath+"/{key}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		if err := validateBlobKey(key); err != nil {
+			serveError(w, http.StatusBadRequest, err)
+			return
+		}
+		user, err := checkAuth(r)
+		if err != nil {
+			serveError(w, http.StatusUnauthorized, err)
+			return
+		}
+		var allowed, public bool
+		gameState.Read(func(gs GameState) {
+			allowed, public = gs.imageAccess(user, key)
+		})
+		if !allowed {
+			// don't reveal whether the image exists
+			serveError(w, http.StatusNotFound, fmt.Errorf("no image %q", key))
+			return
+		}
+		// derived images are regenerated lazily, e.g. after changing the configured sizes
+		if original, variant, ok := parseDerivativeKey(key); ok {
+			exists, err := blobs.Exists(r.Context(), key)
+			if err != nil {
+				serveError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !exists {
+				logf("regenerating missing %s variant of %q", variant, original)
+				if err := generateDerivatives(r.Context(), original, variant); err != nil {
+					logf("failed to regenerate %q: %s", key, err)
+				}
+			}
+		}
+		signedURL, err := blobs.SignedURL(r.Context(), key, signedURLExpiry)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if signedURL != "" {
+			// the redirect must not outlive the signature
+			w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(signedURLExpiry.Seconds())/2))
+			http.Redirect(w, r, signedURL, http.StatusFound)
+			return
+		}
+		data, err := blobs.Get(r.Context(), key)
+		if errors.Is(err, fs.ErrNotExist) {
+			serveError(w, http.StatusNotFound, fmt.Errorf("no image %q", key))
+			return
+		} else if err != nil {
+			serveError(w, http.StatusInternalServerError, err)
+			return
+		}
+		// keys are never reused, so the content never changes, but access may be revoked
+		if public {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+		} else {
+			w.Header().Set("Cache-Control", "private, max-age=3600")
+		}
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(data))
+	})
+
+	handlePage(mux, signup, "/", func(w http.ResponseWriter, r *http.Request, user PlayerName) {
+		gs := gameState.Snapshot()
+		serveTemplate(w, index, gs.gameData(user))
+	})
 
-	mux.Handle("GET /"+imagePath+"/", fileServer)
+	handlePage(mux, signup, "/spaces/{x}/{y}", func(w http.ResponseWriter, r *http.Request, user PlayerName) {
+		x, y, err := parseSpace(r)
+		if err != nil {
+			serveError(w, http.StatusBadRequest, err)
+			return
+		}
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		logf("%s request to %s", r.Method, r.URL)
+		if action := r.FormValue("action"); action != "" {
+			a := SpaceAction{Action: action, Photo: r.FormValue("photo"), Caption: r.FormValue("caption")}
+			if action == "upload" {
+				srcData, err := readUpload(w, r)
+				if err != nil {
+					serveError(w, errorStatus(err, http.StatusBadRequest), err)
+					return
+				}
+				a.Upload, err = storeUpload(r.Context(), user, x, y, srcData, r.FormValue("caption"))
+				if err != nil {
+					serveError(w, errorStatus(err, http.StatusBadRequest), err)
+					return
+				}
+			}
+			if err := performSpaceAction(user, x, y, a); err != nil {
+				serveError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		gs := gameState.Snapshot()
+		pd := gs.Players[user]
+		bs := pd.Board.get(x, y)
+		spaceData := SpaceData{
+			BaseURL:           basePath,
+			Space:             gs.displaySpace(&user, bs),
+			CommentsDisabled:  gs.Settings.CommentsDisabled,
+			ReactionsDisabled: gs.Settings.ReactionsDisabled,
+			Verification:      gs.Settings.verifiers() != VerifyNone,
+			PhotoRequired:     gs.Settings.photoRequired(),
+		}
+		spaceData.Space.Locked = gs.spaceLock(bs) != nil
+		serveTemplate(w, space, spaceData)
+	})
 
+	// the gallery can be viewed without signing up, once it's published
+	mux.HandleFunc("GET /gallery", func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
 		user, err := checkAuth(r)
 		if err != nil {
 			serveError(w, http.StatusUnauthorized, err)
 			return
 		}
-		if user == nil {
-			serveTemplate(w, signup, SignupData{
-				RedirectPath: url.PathEscape(r.URL.Path),
-				BaseURL:      basePath,
-			})
+		gs := gameState.Snapshot()
+		data := gs.galleryIndex(user)
+		serveTemplate(w, gallery, data)
+	})
+
+	mux.HandleFunc("GET /gallery/goals/{goal}", func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
+		user, err := checkAuth(r)
+		if err != nil {
+			serveError(w, http.StatusUnauthorized, err)
 			return
 		}
-		logf("Authorized user %q", *user)
-		gameData := GameData{
-			BaseURL: basePath,
-			User:    *user,
+		goalIdx, err := strconv.Atoi(r.PathValue("goal"))
+		if err != nil || goalIdx < 0 || goalIdx >= len(options) {
+			serveError(w, http.StatusNotFound, fmt.Errorf("no goal %q", r.PathValue("goal")))
+			return
 		}
-		gameState.Read(func(gs GameState) {
-			board := gs.Players[*user].Board
-			gameData.Board = board.display()
-			gameData.Score = board.score()
-		})
-		serveTemplate(w, index, gameData)
+		page, _ := strconv.Atoi(r.FormValue("page"))
+		gs := gameState.Snapshot()
+		data := gs.goalGallery(user, goalIdx, page)
+		serveTemplate(w, gallery, data)
 	})
 
-	mux.HandleFunc("/spaces/{x}/{y}", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /gallery/players/{player}", func(w http.ResponseWriter, r *http.Request) {
 		logf("%s request to %s", r.Method, r.URL)
+		user, err := checkAuth(r)
+		if err != nil {
+			serveError(w, http.StatusUnauthorized, err)
+			return
+		}
+		page, _ := strconv.Atoi(r.FormValue("page"))
+		gs := gameState.Snapshot()
+		data := gs.playerGallery(user, PlayerName(r.PathValue("player")), page)
+		serveTemplate(w, gallery, data)
+	})
 
-		// TODO refactor this auth check
+	mux.HandleFunc("POST /gallery/goals/{goal}/vote", func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
 		user, err := checkAuth(r)
 		if err != nil {
 			serveError(w, http.StatusUnauthorized, err)
 			return
 		}
 		if user == nil {
-			serveTemplate(w, signup, SignupData{
-				RedirectPath: url.PathEscape(r.URL.Path),
-				BaseURL:      basePath,
-			})
+			serveError(w, http.StatusUnauthorized, errors.New("sign up to vote"))
 			return
 		}
-		logf("Authorized user %q", *user)
-
-		x, err := strconv.Atoi(r.PathValue("x"))
-		if err != nil || x < 0 || x >= 5 {
-			serveError(w, http.StatusBadRequest, fmt.Errorf("invalid X value"))
+		goalIdx, err := strconv.Atoi(r.PathValue("goal"))
+		if err != nil || goalIdx < 0 || goalIdx >= len(options) {
+			serveError(w, http.StatusNotFound, fmt.Errorf("no goal %q", r.PathValue("goal")))
+			return
+		}
+		device, err := deviceID(w, r)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, err)
+			return
 		}
-		y, err := strconv.Atoi(r.PathValue("y"))
-		if err != nil || y < 0 || y >= 5 {
-			serveError(w, http.StatusBadRequest, fmt.Errorf("invalid Y value"))
+		err = gameState.ModifyE(func(gs GameState) (GameState, error) {
+			err := gs.castVote(*user, device, goalIdx, r.FormValue("photo"), time.Now())
+			return gs, err
+		})
+		if err != nil {
+			serveError(w, http.StatusBadRequest, err)
+			return
 		}
+		logf("%q voted for %q", *user, r.FormValue("photo"))
+		http.Redirect(w, r, basePath+goalGalleryPath(goalIdx), http.StatusSeeOther)
+	})
 
-		action := r.FormValue("action")
-		uploadFileName := ""
+	handlePage(mux, signup, "GET /leaderboard", func(w http.ResponseWriter, r *http.Request, user PlayerName) {
+		gs := gameState.Snapshot()
+		data := gs.leaderboard(user)
+		serveTemplate(w, leaderboard, data)
+	})
 
-		if action == "upload" {
-			r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-			if err := r.ParseMultipartForm(maxUploadSize); err != nil {
-				serveError(w, http.StatusBadRequest, err)
+	mux.HandleFunc("/photos/{key}", func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
+		user, err := checkAuth(r)
+		if err != nil {
+			serveError(w, http.StatusUnauthorized, err)
+			return
+		}
+		key := r.PathValue("key")
+		action := r.FormValue("action")
+		if action != "" && (r.Method != http.MethodPost || user == nil) {
+			serveError(w, http.StatusBadRequest, errors.New("sign up and use POST to interact with photos"))
+			return
+		}
+		// don't reveal whether inaccessible photos exist
+		errNotFound := fmt.Errorf("no photo %q", key)
+		if action != "" {
+			err = gameState.ModifyE(func(gs GameState) (GameState, error) {
+				if allowed, _ := gs.imageAccess(user, key); !allowed {
+					return gs, errNotFound
+				}
+				if _, ok := gs.locatePhoto(key); !ok {
+					return gs, errNotFound
+				}
+				commentID := r.FormValue("comment")
+				var err error
+				switch action {
+				case "comment":
+					err = gs.addComment(*user, key, r.FormValue("text"), time.Now())
+				case "delete-comment":
+					err = gs.deleteComment(*user, key, commentID, time.Now())
+				case "hide-comment", "unhide-comment":
+					err = gs.setCommentHidden(*user, key, commentID, action == "hide-comment", time.Now())
+				case "report-comment":
+					err = gs.reportComment(*user, key, commentID)
+				case "report-photo":
+					err = gs.reportPhoto(*user, key)
+				case "hide-photo", "unhide-photo":
+					err = gs.setPhotoHidden(*user, key, action == "hide-photo", time.Now())
+				case "dismiss-flags":
+					err = gs.dismissFlags(*user, key, time.Now())
+				case "react":
+					err = gs.toggleReaction(*user, key, r.FormValue("emoji"), time.Now())
+				default:
+					err = fmt.Errorf("unknown action %q", action)
+				}
+				return gs, err
+			})
+			if errors.Is(err, errNotFound) {
+				serveError(w, http.StatusNotFound, err)
 				return
 			}
-			srcFile, header, err := r.FormFile("image_file")
 			if err != nil {
 				serveError(w, http.StatusBadRequest, err)
 				return
 			}
-			defer srcFile.Close()
-			if ct := header.Header.Get("Content-Type"); ct != "image/jpeg" {
-				serveError(w, http.StatusBadRequest, fmt.Errorf("upload must be of type image/jpeg, got %q", ct))
+		}
+		gs := gameState.Snapshot()
+		var (
+			data PhotoPageData
+			ok   bool
+		)
+		if allowed, _ := gs.imageAccess(user, key); allowed {
+			data, ok = gs.photoPage(user, key)
+		}
+		if !ok {
+			serveError(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		serveTemplate(w, photo, data)
+	})
+
+	mux.HandleFunc("POST /notifications/clear", func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
+		user, err := checkAuth(r)
+		if err != nil || user == nil {
+			serveError(w, http.StatusUnauthorized, errors.Join(errors.New("not signed in"), err))
+			return
+		}
+		gameState.Modify(func(gs GameState) GameState {
+			delete(gs.Notifications, *user)
+			return gs
+		})
+		http.Redirect(w, r, basePath+"/", http.StatusSeeOther)
+	})
+
+	handlePage(mux, signup, "/review", func(w http.ResponseWriter, r *http.Request, user PlayerName) {
+		if r.Method == http.MethodPost {
+			x, errX := strconv.Atoi(r.FormValue("x"))
+			y, errY := strconv.Atoi(r.FormValue("y"))
+			if errX != nil || errY != nil || x < 0 || x >= 5 || y < 0 || y >= 5 {
+				serveError(w, http.StatusBadRequest, errors.New("invalid space"))
 				return
 			}
-			encodedPlayerName := base64.URLEncoding.EncodeToString([]byte(*user))
-			randSuffix, err := randStr(6)
+			player := PlayerName(r.FormValue("player"))
+			approve := r.FormValue("decision") == "approve"
+			err := gameState.ModifyE(func(gs GameState) (GameState, error) {
+				err := gs.review(user, player, x, y, r.FormValue("photo"), approve, r.FormValue("reason"), time.Now())
+				return gs, err
+			})
 			if err != nil {
-				serveError(w, http.StatusInternalServerError, fmt.Errorf("generating file name: %w", err))
+				serveError(w, http.StatusBadRequest, err)
 				return
 			}
-			uploadFileName = path.Join(imagePath, fmt.Sprintf("%s.%d.%d.%s.jpg", encodedPlayerName, x, y, randSuffix))
-			dstFile, err := os.Create(uploadFileName)
+			logf("%q reviewed space %d/%d of %q: approved=%t", user, x, y, player, approve)
+			http.Redirect(w, r, basePath+"/review", http.StatusSeeOther)
+			return
+		}
+		gs := gameState.Snapshot()
+		data := ReviewData{BaseURL: basePath, Pending: gs.pendingReviews(user)}
+		serveTemplate(w, review, data)
+	})
+
+	handlePage(mux, signup, "/moderation", func(w http.ResponseWriter, r *http.Request, user PlayerName) {
+		if r.Method == http.MethodPost {
+			player := PlayerName(r.FormValue("player"))
+			action := r.FormValue("action")
+			err := gameState.ModifyE(func(gs GameState) (GameState, error) {
+				var err error
+				switch action {
+				case "reset-space":
+					x, errX := strconv.Atoi(r.FormValue("x"))
+					y, errY := strconv.Atoi(r.FormValue("y"))
+					if errX != nil || errY != nil {
+						return gs, errors.New("invalid space")
+					}
+					err = gs.resetSpace(user, player, x, y, time.Now())
+				case "suspend", "unsuspend":
+					err = gs.setSuspended(user, player, action == "suspend", time.Now())
+				default:
+					err = fmt.Errorf("unknown action %q", action)
+				}
+				return gs, err
+			})
 			if err != nil {
-				serveError(w, http.StatusInternalServerError, fmt.Errorf("failed to create file: %w", err))
-				return
-			}
-			defer dstFile.Close()
-			if _, err := io.Copy(dstFile, srcFile); err != nil {
-				serveError(w, http.StatusInternalServerError, fmt.Errorf("failed to write file: %w", err))
+				serveError(w, http.StatusBadRequest, err)
 				return
 			}
-			if err = dstFile.Close(); err != nil {
-				serveError(w, http.StatusInternalServerError, fmt.Errorf("failed to finish writing file: %w", err))
+			logf("%q moderated %q: %s", user, player, action)
+			http.Redirect(w, r, basePath+"/moderation", http.StatusSeeOther)
+			return
+		}
+		gs := gameState.Snapshot()
+		if !gs.Players[user].Moderator {
+			serveError(w, http.StatusForbidden, errors.New("only moderators may access this page"))
+			return
+		}
+		data := gs.moderationData()
+		serveTemplate(w, moderation, data)
+	})
+
+	handlePage(mux, signup, "GET /audit", func(w http.ResponseWriter, r *http.Request, user PlayerName) {
+		q, err := parseAuditQuery(r.FormValue)
+		if err != nil {
+			serveError(w, http.StatusBadRequest, err)
+			return
+		}
+		format := r.FormValue("format")
+		gs := gameState.Snapshot()
+		if !gs.Players[user].Moderator {
+			serveError(w, http.StatusForbidden, errors.New("only moderators may access this page"))
+			return
+		}
+		if format == "" {
+			serveTemplate(w, audit, gs.auditData(q, r.URL.Query()))
+			return
+		}
+		var buf bytes.Buffer
+		if err := exportAudit(&buf, format, gs.queryAudit(q)); err != nil {
+			serveError(w, http.StatusBadRequest, err)
+			return
+		}
+		contentType := "application/json"
+		if format == "csv" {
+			contentType = "text/csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"audit.%s\"", format))
+		w.Write(buf.Bytes())
+	})
+
+	handlePage(mux, signup, "/snapshots", func(w http.ResponseWriter, r *http.Request, user PlayerName) {
+		isModerator := false
+		gameState.Read(func(gs GameState) {
+			isModerator = gs.Players[user].Moderator
+		})
+		if !isModerator {
+			serveError(w, http.StatusForbidden, errors.New("only moderators may access this page"))
+			return
+		}
+		if r.Method == http.MethodPost {
+			if err := restoreSnapshot(r.FormValue("snapshot"), user, time.Now()); err != nil {
+				serveError(w, http.StatusBadRequest, err)
 				return
 			}
-			if err = srcFile.Close(); err != nil {
-				serveError(w, http.StatusInternalServerError, fmt.Errorf("failed to close file upload: %w", err))
+			http.Redirect(w, r, basePath+"/snapshots", http.StatusSeeOther)
+			return
+		}
+		data := SnapshotsData{BaseURL: basePath, Kept: snapshotsKept(), Saving: saves.Stats()}
+		if data.Kept {
+			var err error
+			data.Snapshots, err = listSnapshots()
+			if err != nil {
+				serveError(w, http.StatusInternalServerError, err)
 				return
 			}
 		}
-		spaceData := SpaceData{
-			BaseURL: basePath,
-		}
-		gameState.Modify(func(gs GameState) GameState {
-			pd := gs.Players[*user]
-			space := pd.Board.get(x, y)
-			needsUpdate := true
-			switch action {
-			case "complete":
-				space.Completed = true
-			case "decomplete":
-				space.Completed = false
-			case "upload":
-				space.Image = uploadFileName
-				space.Completed = true
-			default:
-				needsUpdate = false
-			}
-			if needsUpdate {
-				gs.Players[*user] = pd
-			}
-			spaceData.Space = space.display()
-			return gs
-		})
-		// save changes
-		saveTrigger <- struct{}{}
-		serveTemplate(w, space, spaceData)
+		serveTemplate(w, snapshots, data)
 	})
 
-	// TODO handle /spaces/$x/$y (with auth -> create auth middleware)
+	registerLiveUpdates(mux, liveCtx, liveFragments)
+
+	registerAPI(mux)
 
 	mux.HandleFunc("POST /signup", func(w http.ResponseWriter, r *http.Request) {
 		logf("signup %q", r.FormValue("username"))
@@ -233,8 +540,6 @@ func main() {
 			serveError(w, http.StatusBadRequest, err)
 			return
 		}
-		// save new user
-		saveTrigger <- struct{}{}
 		http.Redirect(w, r, basePath+path, http.StatusSeeOther)
 	})
 
@@ -243,6 +548,7 @@ func main() {
 		Addr:    "localhost:8081",
 		Handler: mux,
 	}
+	srv.RegisterOnShutdown(stopLive)
 	sigCtx, sigStop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer sigStop()
 	wg := new(sync.WaitGroup)
@@ -252,10 +558,23 @@ func main() {
 		err := srv.ListenAndServe()
 		logf("ListenAndServe exited: %s", err)
 	}()
+	// saving stops only after everything else, so the final save includes all changes
+	saveCtx, stopSaving := context.WithCancel(context.Background())
+	defer stopSaving()
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		saves.run(saveCtx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runGarbageCollection(sigCtx)
+	}()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		saveState(sigCtx, saveTrigger)
+		hashMissingPhotos(sigCtx)
 	}()
 
 	<-sigCtx.Done()
@@ -268,10 +587,36 @@ func main() {
 		logf("shutdown err: %s", err)
 	}
 	wg.Wait()
+	stopSaving()
+	<-saved
+	if err := store.Close(); err != nil {
+		log.Printf("failed to close state store: %s", err)
+	}
 
 	log.Print("goodbye")
 }
 
+// handlePage registers a page for signed up players, which shows the sign up form to everyone else.
+func handlePage(mux *http.ServeMux, signup *template.Template, pattern string, handler func(w http.ResponseWriter, r *http.Request, user PlayerName)) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		logf("%s request to %s", r.Method, r.URL)
+		user, err := checkAuth(r)
+		if err != nil {
+			serveError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if user == nil {
+			serveTemplate(w, signup, SignupData{
+				RedirectPath: url.PathEscape(r.URL.Path),
+				BaseURL:      basePath,
+			})
+			return
+		}
+		logf("Authorized user %q", *user)
+		handler(w, r, *user)
+	})
+}
+
 func serveTemplate(w http.ResponseWriter, t *template.Template, data any) {
 	//logf("serving template %q with data %#v", t.Name(), data)
 	logf("serving template %q", t.Name())
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stateMigrations upgrade the state loaded from an older version of the code, one [GameState.Version] at a time:
+// the migration at index i turns version i into version i+1. Changes to the format append a migration here.
+// Since state is unmarshaled into the current [GameState] first, renamed or restructured fields have to keep
+// their old version around, marked as deprecated, until the migration has moved their contents.
+// Each version needs a fixture in testdata, see migrations_test.go.
+var stateMigrations = []func(gs *GameState) error{
+	migrateSingleImage, // 0 → 1
+}
+
+// currentStateVersion is the version of state written by this version of the code.
+func currentStateVersion() int {
+	return len(stateMigrations)
+}
+
+// migrateState upgrades the state to [currentStateVersion].
+func migrateState(gs *GameState) error {
+	if gs.Version > currentStateVersion() {
+		return fmt.Errorf("state has version %d, but this version of the code only supports up to %d", gs.Version, currentStateVersion())
+	}
+	for gs.Version < currentStateVersion() {
+		if err := stateMigrations[gs.Version](gs); err != nil {
+			return fmt.Errorf("migrating state from version %d: %w", gs.Version, err)
+		}
+		gs.Version++
+		logf("migrated state to version %d", gs.Version)
+	}
+	return nil
+}
+
+// migrateSingleImage converts spaces, which used to have a single image referenced by its path in the local image directory,
+// to a list of photos referenced by blob key.
+func migrateSingleImage(gs *GameState) error {
+	for name, ps := range gs.Players {
+		for x := range 5 {
+			for y := range 5 {
+				space := ps.Board.get(x, y)
+				if space.Image == "" {
+					continue
+				}
+				key := strings.TrimPrefix(space.Image, imagePath+"/")
+				space.Photos = append(space.Photos, Photo{Key: key})
+				space.Hero = key
+				space.Image = ""
+			}
+		}
+		gs.Players[name] = ps
+	}
+	return nil
+}
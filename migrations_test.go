@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every state version has a fixture in testdata/state-v<version>.json, as written by that version of the code,
+// and each migration is tested on its own by turning one into the next. Fixtures with a suffix,
+// like testdata/state-v1-verified.json, cover further settings of the current version.
+
+func readTestState(t *testing.T, path string) GameState {
+	t.Helper()
+	gs, err := readSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gs
+}
+
+func stateFixture(version int) string {
+	return fmt.Sprintf("testdata/state-v%d.json", version)
+}
+
+func TestStateMigrationSteps(t *testing.T) {
+	for version, migrate := range stateMigrations {
+		t.Run(fmt.Sprintf("%d→%d", version, version+1), func(t *testing.T) {
+			gs := readTestState(t, stateFixture(version))
+			if gs.Version != version {
+				t.Fatalf("version of %s = %d, want %d", stateFixture(version), gs.Version, version)
+			}
+			if err := migrate(&gs); err != nil {
+				t.Fatal(err)
+			}
+			gs.Version++
+			want := readTestState(t, stateFixture(version+1))
+			if g, w := mustJSON(t, gs), mustJSON(t, want); g != w {
+				t.Errorf("migrated state differs from %s\ngot:  %s\nwant: %s", stateFixture(version+1), g, w)
+			}
+		})
+	}
+}
+
+func TestMigrateStateFromV0(t *testing.T) {
+	gs := readTestState(t, stateFixture(0))
+	if err := migrateState(&gs); err != nil {
+		t.Fatal(err)
+	}
+	want := readTestState(t, stateFixture(currentStateVersion()))
+	if g, w := mustJSON(t, gs), mustJSON(t, want); g != w {
+		t.Errorf("migrated state differs from %s\ngot:  %s\nwant: %s", stateFixture(currentStateVersion()), g, w)
+	}
+}
+
+func TestMigrateStateCurrent(t *testing.T) {
+	paths, err := filepath.Glob(fmt.Sprintf("testdata/state-v%d*.json", currentStateVersion()))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures of the current version %d: %v", currentStateVersion(), err)
+	}
+	for _, path := range paths {
+		gs := readTestState(t, path)
+		if gs.Version != currentStateVersion() {
+			t.Fatalf("version of %s = %d, want %d", path, gs.Version, currentStateVersion())
+		}
+		want := mustJSON(t, gs)
+		if err := migrateState(&gs); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustJSON(t, gs); got != want {
+			t.Errorf("%s changed by migrating\ngot:  %s\nwant: %s", path, got, want)
+		}
+	}
+}
+
+func TestMigrateStateRejectsFutureVersion(t *testing.T) {
+	gs := readTestState(t, stateFixture(currentStateVersion()))
+	gs.Version = currentStateVersion() + 1
+	err := migrateState(&gs)
+	if err == nil || !strings.Contains(err.Error(), "only supports up to") {
+		t.Errorf("migrating a future version: got error %v, want it to be rejected", err)
+	}
+	if gs.Version != currentStateVersion()+1 {
+		t.Errorf("version after rejected migration = %d, want it unchanged", gs.Version)
+	}
+}
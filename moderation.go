@@ -0,0 +1,229 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type ModerationData struct {
+	BaseURL     string
+	Reported    []FlaggedPhoto
+	OutOfWindow []FlaggedPhoto
+	Duplicates  []DuplicateGroup
+	Comments    []ReportedComment
+	Suspended   []PlayerName
+	Audit       []AuditEntry
+}
+
+// FlaggedPhoto is a photo shown to moderators, along with where it was uploaded.
+type FlaggedPhoto struct {
+	Player  PlayerName
+	X, Y    int
+	Goal    Goal
+	Photo   DisplayPhoto
+	Taken   time.Time
+	Reports []PlayerName
+	Hidden  bool
+}
+
+// DuplicateGroup is a photo and the previously uploaded photos it looks like.
+type DuplicateGroup struct {
+	FlaggedPhoto
+	Similar []FlaggedPhoto
+}
+
+func (loc *PhotoLocation) flagged() FlaggedPhoto {
+	return FlaggedPhoto{
+		Player:  loc.Player,
+		X:       loc.X,
+		Y:       loc.Y,
+		Goal:    loc.Goal,
+		Photo:   loc.Photo.display(),
+		Taken:   loc.Photo.Taken,
+		Reports: loc.Photo.Reports,
+		Hidden:  loc.Photo.Hidden,
+	}
+}
+
+// outOfWindow reports whether the photo was taken outside of the game, according to its EXIF data.
+func (photo *Photo) outOfWindow(settings GameSettings) bool {
+	if photo.Taken.IsZero() {
+		return false
+	}
+	return (!settings.Start.IsZero() && photo.Taken.Before(settings.Start)) ||
+		(!settings.End.IsZero() && photo.Taken.After(settings.End))
+}
+
+// flaggedPhotos returns the photos players reported and those taken outside of the game window.
+func (gs *GameState) flaggedPhotos() (reported []FlaggedPhoto, outOfWindow []FlaggedPhoto) {
+	for name, ps := range gs.Players {
+		for x := range 5 {
+			for y := range 5 {
+				space := ps.Board.get(x, y)
+				for _, photo := range space.Photos {
+					loc := newPhotoLocation(name, x, y, space, photo)
+					if len(photo.Reports) > 0 {
+						reported = append(reported, loc.flagged())
+					}
+					if photo.outOfWindow(gs.Settings) && !photo.Dismissed {
+						outOfWindow = append(outOfWindow, loc.flagged())
+					}
+				}
+			}
+		}
+	}
+	newestFirst := func(a, b FlaggedPhoto) int {
+		return b.Photo.Uploaded.Compare(a.Photo.Uploaded)
+	}
+	slices.SortFunc(reported, newestFirst)
+	slices.SortFunc(outOfWindow, newestFirst)
+	return reported, outOfWindow
+}
+
+func (gs *GameState) moderationData() ModerationData {
+	res := ModerationData{BaseURL: basePath}
+	res.Reported, res.OutOfWindow = gs.flaggedPhotos()
+	for _, loc := range gs.flaggedDuplicates() {
+		group := DuplicateGroup{FlaggedPhoto: loc.flagged()}
+		for _, key := range loc.Photo.SimilarTo {
+			// the other photo may have been deleted since
+			if similar, ok := gs.locatePhoto(key); ok {
+				group.Similar = append(group.Similar, similar.flagged())
+			}
+		}
+		if len(group.Similar) > 0 {
+			res.Duplicates = append(res.Duplicates, group)
+		}
+	}
+	// newest first, the players are iterated in random order
+	slices.SortFunc(res.Duplicates, func(a, b DuplicateGroup) int {
+		return cmp.Or(b.Photo.Uploaded.Compare(a.Photo.Uploaded), cmp.Compare(a.Photo.Key, b.Photo.Key))
+	})
+	res.Comments = gs.reportedComments()
+	for name, ps := range gs.Players {
+		if ps.Suspended {
+			res.Suspended = append(res.Suspended, name)
+		}
+	}
+	slices.Sort(res.Suspended)
+	res.Audit = recentAudit(gs.AuditLog, maxAuditEntriesShown)
+	return res
+}
+
+// modifyPhoto calls f with the photo with the given key, if it exists, and returns where it was before.
+func (gs *GameState) modifyPhoto(key string, f func(photo *Photo)) (PhotoLocation, error) {
+	loc, ok := gs.locatePhoto(key)
+	if !ok {
+		return loc, fmt.Errorf("no photo %q", key)
+	}
+	ps := gs.Players[loc.Player]
+	f(ps.Board.get(loc.X, loc.Y).photo(key))
+	gs.Players[loc.Player] = ps
+	return loc, nil
+}
+
+func (gs *GameState) reportPhoto(reporter PlayerName, key string) error {
+	_, err := gs.modifyPhoto(key, func(photo *Photo) {
+		if !slices.Contains(photo.Reports, reporter) {
+			photo.Reports = append(photo.Reports, reporter)
+		}
+	})
+	return err
+}
+
+// setPhotoHidden hides a photo from everyone but its owner and moderators, or makes it visible again.
+func (gs *GameState) setPhotoHidden(actor PlayerName, key string, hidden bool, now time.Time) error {
+	if !gs.Players[actor].Moderator {
+		return errors.New("only moderators may hide photos")
+	}
+	loc, err := gs.modifyPhoto(key, func(photo *Photo) {
+		photo.Hidden = hidden
+		// either way, a moderator has dealt with the reports
+		photo.Reports = nil
+	})
+	if err != nil {
+		return err
+	}
+	action := "unhide-photo"
+	if hidden {
+		action = "hide-photo"
+	}
+	gs.audit(AuditEntry{At: now, Actor: actor, Action: action, Player: loc.Player, Target: key})
+	return nil
+}
+
+// dismissFlags clears the reports on a photo and excludes it from automatic flagging.
+func (gs *GameState) dismissFlags(actor PlayerName, key string, now time.Time) error {
+	if !gs.Players[actor].Moderator {
+		return errors.New("only moderators may dismiss flags")
+	}
+	loc, err := gs.modifyPhoto(key, func(photo *Photo) {
+		photo.Reports = nil
+		photo.Dismissed = true
+	})
+	if err != nil {
+		return err
+	}
+	gs.audit(AuditEntry{At: now, Actor: actor, Action: "dismiss-flags", Player: loc.Player, Target: key, Detail: joinPlayers(loc.Photo.Reports)})
+	return nil
+}
+
+// resetSpace removes all photos from a player's space and marks it as not completed.
+func (gs *GameState) resetSpace(actor PlayerName, player PlayerName, x, y int, now time.Time) error {
+	if !gs.Players[actor].Moderator {
+		return errors.New("only moderators may reset spaces")
+	}
+	ps, ok := gs.Players[player]
+	if !ok {
+		return fmt.Errorf("unknown player %q", player)
+	}
+	if x < 0 || x >= 5 || y < 0 || y >= 5 {
+		return errors.New("invalid space")
+	}
+	space := ps.Board.get(x, y)
+	if space.GoalIdx == freeGoalIdx {
+		return errors.New("the free space cannot be reset")
+	}
+	gs.audit(AuditEntry{
+		At:     now,
+		Actor:  actor,
+		Action: "reset-space",
+		Player: player,
+		Target: spaceTarget(x, y, space),
+		Before: joinKeys(space.Photos),
+	})
+	for _, photo := range space.Photos {
+		gs.discardImage(photo.Key, now)
+	}
+	space.Photos = nil
+	space.Hero = ""
+	space.Review = nil
+	space.Completed = false
+	gs.Players[player] = ps
+	return nil
+}
+
+// setSuspended prevents a player from signing in, or allows it again.
+func (gs *GameState) setSuspended(actor PlayerName, player PlayerName, suspended bool, now time.Time) error {
+	if !gs.Players[actor].Moderator {
+		return errors.New("only moderators may suspend players")
+	}
+	if actor == player {
+		return errors.New("you cannot suspend yourself")
+	}
+	ps, ok := gs.Players[player]
+	if !ok {
+		return fmt.Errorf("unknown player %q", player)
+	}
+	ps.Suspended = suspended
+	gs.Players[player] = ps
+	action := "unsuspend"
+	if suspended {
+		action = "suspend"
+	}
+	gs.audit(AuditEntry{At: now, Actor: actor, Action: action, Player: player})
+	return nil
+}
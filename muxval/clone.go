@@ -0,0 +1,67 @@
+package muxval
+
+import "reflect"
+
+// DeepCopy returns a copy of v which shares no maps, slices or pointers with it, preserving nil-ness.
+// Unexported struct fields are copied shallowly, which is fine for immutable types like [time.Time].
+// Values containing cycles are not supported.
+func DeepCopy[T any](v T) T {
+	var res T
+	src := reflect.ValueOf(&v).Elem()
+	reflect.ValueOf(&res).Elem().Set(deepCopy(src))
+	return res
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			res.SetMapIndex(deepCopy(iter.Key()), deepCopy(iter.Value()))
+		}
+		return res
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			res.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return res
+	case reflect.Array:
+		res := reflect.New(v.Type()).Elem()
+		for i := range v.Len() {
+			res.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return res
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.New(v.Type().Elem())
+		res.Elem().Set(deepCopy(v.Elem()))
+		return res
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.New(v.Type()).Elem()
+		res.Set(deepCopy(v.Elem()))
+		return res
+	case reflect.Struct:
+		res := reflect.New(v.Type()).Elem()
+		res.Set(v) // including unexported fields
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				res.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return res
+	default:
+		return v
+	}
+}
@@ -0,0 +1,64 @@
+package muxval
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type cloneInner struct {
+	Tags []string
+}
+
+type cloneOuter struct {
+	Name    string
+	At      time.Time
+	ByName  map[string][]int
+	Inner   cloneInner
+	Ptr     *cloneInner
+	Grid    [2][]int
+	Any     any
+	NilMap  map[string]int
+	NilList []int
+	private []int
+}
+
+func TestDeepCopy(t *testing.T) {
+	orig := cloneOuter{
+		Name:    "orig",
+		At:      time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		ByName:  map[string][]int{"a": {1, 2}},
+		Inner:   cloneInner{Tags: []string{"x"}},
+		Ptr:     &cloneInner{Tags: []string{"y"}},
+		Grid:    [2][]int{{1}, {2}},
+		Any:     []int{3},
+		private: []int{4},
+	}
+	c := DeepCopy(orig)
+	if !reflect.DeepEqual(c, orig) {
+		t.Fatalf("copy = %+v, want %+v", c, orig)
+	}
+	if c.NilMap != nil || c.NilList != nil {
+		t.Error("nil map or slice copied as empty")
+	}
+
+	c.ByName["a"][0] = 100
+	c.ByName["b"] = nil
+	c.Inner.Tags[0] = "changed"
+	c.Ptr.Tags[0] = "changed"
+	c.Grid[1][0] = 100
+	c.Any.([]int)[0] = 100
+	if len(orig.ByName) != 1 || orig.ByName["a"][0] != 1 {
+		t.Errorf("map shared with the copy: %v", orig.ByName)
+	}
+	if orig.Inner.Tags[0] != "x" || orig.Ptr.Tags[0] != "y" {
+		t.Error("nested slice or pointer shared with the copy")
+	}
+	if orig.Grid[1][0] != 2 || orig.Any.([]int)[0] != 3 {
+		t.Error("slice in array or interface shared with the copy")
+	}
+	// unexported fields are documented to be copied shallowly
+	if &c.private[0] != &orig.private[0] {
+		t.Error("unexported field was deep copied")
+	}
+}
@@ -2,19 +2,128 @@ package muxval
 
 import "sync"
 
+// MuxVal guards a value with a mutex. Readers don't block each other, only writers.
 type MuxVal[T any] struct {
-	mu  sync.Mutex
-	val T
+	// Clone returns a deep copy of the value, which shares no maps, slices or pointers with it.
+	// It is required by [MuxVal.Snapshot] and [MuxVal.ModifyE], see [DeepCopy].
+	Clone func(T) T
+
+	mu      sync.RWMutex
+	val     T
+	version uint64 // incremented by every Modify
+
+	snapMu      sync.Mutex
+	snap        T
+	snapVersion uint64
+	snapValid   bool
+
+	subMu       sync.Mutex
+	subscribers map[int]func(version uint64)
+	nextSub     int
 }
 
+// Modify replaces the value with the result of f, which may modify the value in place.
 func (mv *MuxVal[T]) Modify(f func(T) T) {
+	mv.notify(mv.modify(f))
+}
+
+func (mv *MuxVal[T]) modify(f func(T) T) uint64 {
 	mv.mu.Lock()
 	defer mv.mu.Unlock()
 	mv.val = f(mv.val)
+	mv.version++
+	return mv.version
 }
 
-func (mv *MuxVal[T]) Read(f func(T)) {
+// ModifyE is a transactional [MuxVal.Modify]: f works on a clone of the value,
+// which only replaces the value if f returns no error. If f fails or panics, the value remains untouched.
+func (mv *MuxVal[T]) ModifyE(f func(T) (T, error)) error {
+	version, err := mv.modifyE(f)
+	if err != nil {
+		return err
+	}
+	mv.notify(version)
+	return nil
+}
+
+func (mv *MuxVal[T]) modifyE(f func(T) (T, error)) (uint64, error) {
 	mv.mu.Lock()
 	defer mv.mu.Unlock()
+	val, err := f(mv.Clone(mv.val))
+	if err != nil {
+		return 0, err
+	}
+	mv.val = val
+	mv.version++
+	return mv.version, nil
+}
+
+// Read calls f with the live value, which f must not modify, nor keep references into after returning.
+func (mv *MuxVal[T]) Read(f func(T)) {
+	mv.mu.RLock()
+	defer mv.mu.RUnlock()
 	f(mv.val)
 }
+
+// Version returns the number of modifications so far.
+func (mv *MuxVal[T]) Version() uint64 {
+	mv.mu.RLock()
+	defer mv.mu.RUnlock()
+	return mv.version
+}
+
+// Snapshot returns an immutable copy of the value, which stays valid while the value is modified.
+// The copy is only made once per modification and shared by all callers, so it must not be modified.
+func (mv *MuxVal[T]) Snapshot() T {
+	mv.mu.RLock()
+	version := mv.version
+	mv.snapMu.Lock()
+	if mv.snapValid && mv.snapVersion == version {
+		snap := mv.snap
+		mv.snapMu.Unlock()
+		mv.mu.RUnlock()
+		return snap
+	}
+	mv.snapMu.Unlock()
+	// concurrent callers may both end up cloning, but neither blocks writers for longer than the copy takes
+	snap := mv.Clone(mv.val)
+	mv.mu.RUnlock()
+
+	mv.snapMu.Lock()
+	defer mv.snapMu.Unlock()
+	if !mv.snapValid || mv.snapVersion < version {
+		mv.snap, mv.snapVersion, mv.snapValid = snap, version, true
+	}
+	return snap
+}
+
+// Subscribe calls f with the new version after every modification until unsubscribed.
+// f is called by the modifying goroutine once the lock is released, so it may read the value,
+// but it must not block. Concurrent modifications may be delivered out of order, compare the versions.
+func (mv *MuxVal[T]) Subscribe(f func(version uint64)) (unsubscribe func()) {
+	mv.subMu.Lock()
+	defer mv.subMu.Unlock()
+	if mv.subscribers == nil {
+		mv.subscribers = map[int]func(uint64){}
+	}
+	id := mv.nextSub
+	mv.nextSub++
+	mv.subscribers[id] = f
+	return func() {
+		mv.subMu.Lock()
+		defer mv.subMu.Unlock()
+		delete(mv.subscribers, id)
+	}
+}
+
+func (mv *MuxVal[T]) notify(version uint64) {
+	mv.subMu.Lock()
+	subscribers := make([]func(uint64), 0, len(mv.subscribers))
+	for _, f := range mv.subscribers {
+		subscribers = append(subscribers, f)
+	}
+	mv.subMu.Unlock()
+	for _, f := range subscribers {
+		f(version)
+	}
+}
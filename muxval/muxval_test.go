@@ -0,0 +1,144 @@
+package muxval
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// ledger is consistent if the sum of Balances equals the length of Entries.
+type ledger struct {
+	Balances map[string]int
+	Entries  []string
+}
+
+func (l ledger) consistent() bool {
+	sum := 0
+	for _, b := range l.Balances {
+		sum += b
+	}
+	return sum == len(l.Entries)
+}
+
+func (l ledger) book(name string) ledger {
+	if l.Balances == nil {
+		l.Balances = map[string]int{}
+	}
+	l.Balances[name]++
+	l.Entries = append(l.Entries, name)
+	return l
+}
+
+func newLedger() *MuxVal[ledger] {
+	mv := &MuxVal[ledger]{Clone: DeepCopy[ledger]}
+	mv.Modify(func(l ledger) ledger { return l.book("a") })
+	return mv
+}
+
+func TestModifyERollsBackOnError(t *testing.T) {
+	mv := newLedger()
+	notified := 0
+	mv.Subscribe(func(uint64) { notified++ })
+	errFailed := errors.New("failed")
+	err := mv.ModifyE(func(l ledger) (ledger, error) {
+		l = l.book("b")
+		l.Balances["a"] = 100
+		return l, errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("ModifyE returned %v, want %v", err, errFailed)
+	}
+	mv.Read(func(l ledger) {
+		if len(l.Balances) != 1 || l.Balances["a"] != 1 || len(l.Entries) != 1 {
+			t.Errorf("value after failed ModifyE = %+v, want it unchanged", l)
+		}
+	})
+	if v := mv.Version(); v != 1 {
+		t.Errorf("version after failed ModifyE = %d, want 1", v)
+	}
+	if notified != 0 {
+		t.Errorf("subscribers notified %d times of a failed ModifyE", notified)
+	}
+}
+
+func TestModifyERollsBackOnPanic(t *testing.T) {
+	mv := newLedger()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("ModifyE didn't pass on the panic")
+			}
+		}()
+		mv.ModifyE(func(l ledger) (ledger, error) {
+			l.book("b")
+			panic("oops")
+		})
+	}()
+	// would deadlock if the lock was still held
+	mv.Modify(func(l ledger) ledger { return l.book("c") })
+	mv.Read(func(l ledger) {
+		if l.Balances["b"] != 0 || len(l.Entries) != 2 {
+			t.Errorf("value after panicking ModifyE = %+v, want only its changes missing", l)
+		}
+	})
+}
+
+// TestConcurrentAccess is mostly useful with -race.
+func TestConcurrentAccess(t *testing.T) {
+	mv := newLedger()
+	const workers, rounds = 4, 200
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				mv.Modify(func(l ledger) ledger { return l.book("modify") })
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				mv.ModifyE(func(l ledger) (ledger, error) {
+					l = l.book("modifyE")
+					if i%2 == 1 {
+						return l, errors.New("every other one fails")
+					}
+					return l, nil
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				if snap := mv.Snapshot(); !snap.consistent() {
+					t.Errorf("inconsistent snapshot %+v", snap)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	snap := mv.Snapshot()
+	if got, want := snap.Balances["modify"], workers*rounds; got != want {
+		t.Errorf("%d successful Modify calls, want %d", got, want)
+	}
+	if got, want := snap.Balances["modifyE"], workers*rounds/2; got != want {
+		t.Errorf("%d successful ModifyE calls, want %d", got, want)
+	}
+	if !snap.consistent() {
+		t.Errorf("inconsistent final snapshot %+v", snap)
+	}
+}
+
+func TestSnapshotIsShared(t *testing.T) {
+	mv := newLedger()
+	a, b := mv.Snapshot(), mv.Snapshot()
+	if &a.Entries[0] != &b.Entries[0] {
+		t.Error("snapshots of the same version were copied twice")
+	}
+	mv.Modify(func(l ledger) ledger { return l.book("b") })
+	if c := mv.Snapshot(); &c.Entries[0] == &a.Entries[0] || len(a.Entries) != 1 {
+		t.Error("snapshot not updated after Modify")
+	}
+}
@@ -1,82 +1,191 @@
 package main
 
 import (
-	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
-func saveState(ctx context.Context, trigger <-chan struct{}) {
-	exit := false
-	for !exit {
-		select {
-		case <-ctx.Done():
-			logf("State saving canceled; performing final save.")
-			exit = true
-			// still perform one last save (though it should not be necessary)
-		case <-trigger:
-			logf("State saving triggered.")
-			// drain trigger channel
-			drained := false
-			for !drained {
-				select {
-				case <-trigger:
-				default:
-					drained = true
-				}
-			}
-		}
-		var stateJSON []byte
-		var err error
-		gameState.Read(func(gs GameState) {
-			stateJSON, err = json.Marshal(gs)
-		})
-		if err != nil {
-			log.Printf("failed to marshal game state: %s", err)
-			continue
-		}
-		_, err = os.Stat(latestStatePath)
-		if err == nil {
-			// move latest state to backup, replacing it (FIXME: this assumes the latest state was written successfuly, which may not necessarily be the case)
-			err = os.Remove(previousStatePath)
-			if err != nil && !errors.Is(err, os.ErrNotExist) {
-				log.Printf("failed to remove state backup %q: %s", previousStatePath, err)
-			}
-			err = os.Rename(latestStatePath, previousStatePath)
-			if err != nil {
-				log.Printf("failed to back up previous state %q to %q: %s", latestStatePath, previousStatePath, err)
-				// still continue and overwrite it, we care more about losing the latest updates than the backup
-			}
-		}
-		err = os.WriteFile(latestStatePath, stateJSON, 0600)
-		if err != nil {
-			log.Printf("failed to write state file %q: %s", latestStatePath, err)
-			continue
+// writeState persists the current [gameState], writing a new snapshot if the [StateStore] uses them.
+func writeState() error {
+	return persistChanges(true)
+}
+
+var (
+	// persistMu serializes [persistChanges], which is called both by [saveScheduler] and when restoring snapshots.
+	persistMu sync.Mutex
+	store     StateStore
+	// the game state as it was last persisted, guarded by persistMu
+	persisted stateShadow
+)
+
+// persistChanges saves the changes to [gameState] since the last call to the [store].
+// If compact is set, stores that write snapshots do so even if it's not yet due.
+func persistChanges(compact bool) error {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+	now := time.Now()
+	// a snapshot, so neither diffing nor marshaling blocks changes
+	gs := gameState.Snapshot()
+	changes, shadow, err := persisted.diff(&gs)
+	var stateJSON []byte
+	if err == nil && store.WantsSnapshot(compact, len(changes) > 0, now) {
+		stateJSON, err = json.Marshal(gs)
+	}
+	if err != nil {
+		return fmt.Errorf("marshaling game state: %w", err)
+	}
+	if len(changes) == 0 && stateJSON == nil {
+		return nil
+	}
+	if err := store.Save(changes, stateJSON, now); err != nil {
+		// the next attempt will include these changes again
+		return err
+	}
+	persisted = shadow
+	return nil
+}
+
+// stateFile is the format of snapshots, whose checksum reveals truncated or otherwise corrupted files.
+// Older snapshots are a bare [GameState] without checksum.
+type stateFile struct {
+	SHA256 string          `json:"sha256"` // hex encoded, of State
+	State  json.RawMessage `json:"state"`
+}
+
+// writeSnapshot atomically replaces [latestStatePath], keeping the previous version in [previousStatePath].
+// At no point is there no complete latest state, even if the process crashes.
+func writeSnapshot(stateJSON []byte) error {
+	sum := sha256.Sum256(stateJSON)
+	data, err := json.Marshal(stateFile{SHA256: hex.EncodeToString(sum[:]), State: stateJSON})
+	if err != nil {
+		return fmt.Errorf("marshaling state file: %w", err)
+	}
+	// a corrupted latest state must not replace a valid backup
+	latest, err := os.ReadFile(latestStatePath)
+	if err == nil {
+		_, err = decodeSnapshotJSON(latestStatePath, latest)
+	}
+	if err == nil {
+		// a copy rather than a hard link, which would share the file with the snapshots linked to the latest state
+		if err := writeFileAtomic(previousStatePath, latest); err != nil {
+			// still continue and replace it, we care more about losing the latest updates than the backup
+			log.Printf("failed to back up previous state %q to %q: %s", latestStatePath, previousStatePath, err)
 		}
-		logf("state successfully saved to %q", latestStatePath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("not backing up invalid state %q: %s", latestStatePath, err)
+	}
+	return writeFileAtomic(latestStatePath, data)
+}
+
+// writeFileAtomic writes to a temporary file which then replaces the given one,
+// syncing both the file and the directory so the change survives a crash.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary file for %q: %w", path, err)
+	}
+	defer os.Remove(f.Name()) // fails harmlessly once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %q: %w", f.Name(), err)
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return fmt.Errorf("changing mode of %q: %w", f.Name(), err)
 	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing %q: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing %q: %w", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("replacing %q: %w", path, err)
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening directory %q: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("syncing directory %q: %w", dir, err)
+	}
+	return nil
+}
+
+// readSnapshotJSON reads a snapshot written by [writeSnapshot] and returns the verified state JSON.
+func readSnapshotJSON(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSnapshotJSON(path, data)
+}
+
+// decodeSnapshotJSON returns the state JSON of the file read from path, after verifying its checksum.
+func decodeSnapshotJSON(path string, data []byte) ([]byte, error) {
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("unmarshaling state file %q: %w", path, err)
+	}
+	if file.SHA256 == "" {
+		// written before checksums were introduced
+		return data, nil
+	}
+	if sum := sha256.Sum256(file.State); hex.EncodeToString(sum[:]) != file.SHA256 {
+		return nil, fmt.Errorf("state file %q: checksum mismatch", path)
+	}
+	return file.State, nil
 }
 
+func readSnapshot(path string) (GameState, error) {
+	var res GameState
+	stateJSON, err := readSnapshotJSON(path)
+	if err != nil {
+		return res, err
+	}
+	if err := json.Unmarshal(stateJSON, &res); err != nil {
+		return res, fmt.Errorf("unmarshaling state file %q: %w", path, err)
+	}
+	return res, nil
+}
+
+// stateLock keeps commands from changing the state while the server runs, and the other way around.
+var stateLock *os.File
+
+// loadState locks the state, sets up the [store] and loads the [gameState] from it.
 func loadState() error {
-	var loadedState GameState
-	stateJSON, err := os.ReadFile(latestStatePath)
+	var err error
+	stateLock, err = lockState()
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			// first launch / no saved state -> done
-			return nil
-		}
-		return fmt.Errorf("reading state file %q: %w", latestStatePath, err)
+		return err
 	}
-	err = json.Unmarshal(stateJSON, &loadedState)
+	store, err = newStateStoreFromEnv()
 	if err != nil {
-		return fmt.Errorf("unmarshaling state file %q: %w", latestStatePath, err)
+		return err
+	}
+	loadedState, err := store.Load()
+	if err != nil {
+		return err
+	}
+	// the shadow reflects what's in the store, so the migration is persisted with the next save
+	stored := cloneGameState(loadedState)
+	persisted = stateShadow{state: &stored}
+	if err := migrateState(&loadedState); err != nil {
+		return err
 	}
 	gameState.Modify(func(gs GameState) GameState {
 		return loadedState
 	})
-	logf("game state loaded from %q", latestStatePath)
 	return nil
 }
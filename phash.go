@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"math/bits"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// perceptualHash computes a difference hash (dHash) of a JPEG:
+// the image is scaled down to 9x8 grayscale pixels and each bit records whether a pixel is brighter than its right neighbor.
+// Similar images have hashes with a small Hamming distance, regardless of resolution and compression.
+func perceptualHash(data []byte) (string, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decoding image: %w", err)
+	}
+	img = applyOrientation(img, jpegOrientation(data))
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
+
+// hashDistance returns the number of differing bits between two hashes from [perceptualHash],
+// or -1 if either is invalid (e.g. not computed yet).
+func hashDistance(a, b string) int {
+	x, errA := strconv.ParseUint(a, 16, 64)
+	y, errB := strconv.ParseUint(b, 16, 64)
+	if errA != nil || errB != nil {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// similarPhotos returns all photos similar to the given hash, except for those on the given space,
+// since alternative shots for the same goal are expected to look alike.
+func (gs *GameState) similarPhotos(hash string, owner PlayerName, x, y int) []PhotoLocation {
+	var res []PhotoLocation
+	for name, ps := range gs.Players {
+		for px := range 5 {
+			for py := range 5 {
+				if name == owner && px == x && py == y {
+					continue
+				}
+				for _, photo := range ps.Board.get(px, py).Photos {
+					if d := hashDistance(hash, photo.Hash); d >= 0 && d <= maxDuplicateHashDistance {
+						res = append(res, newPhotoLocation(name, px, py, ps.Board.get(px, py), photo))
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// flaggedDuplicates returns all photos which are similar to another one, for moderators to review.
+func (gs *GameState) flaggedDuplicates() []PhotoLocation {
+	var res []PhotoLocation
+	for name, ps := range gs.Players {
+		for x := range 5 {
+			for y := range 5 {
+				for _, photo := range ps.Board.get(x, y).Photos {
+					if len(photo.SimilarTo) > 0 && !photo.Dismissed {
+						res = append(res, newPhotoLocation(name, x, y, ps.Board.get(x, y), photo))
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// hashMissingPhotos computes the perceptual hashes of photos uploaded before hashing was introduced.
+func hashMissingPhotos(ctx context.Context) {
+	type missing struct {
+		player PlayerName
+		x, y   int
+		key    string
+	}
+	var todo []missing
+	gameState.Read(func(gs GameState) {
+		for name, ps := range gs.Players {
+			for x := range 5 {
+				for y := range 5 {
+					for _, photo := range ps.Board.get(x, y).Photos {
+						if photo.Hash == "" {
+							todo = append(todo, missing{name, x, y, photo.Key})
+						}
+					}
+				}
+			}
+		}
+	})
+	for _, m := range todo {
+		if ctx.Err() != nil {
+			return
+		}
+		data, err := blobs.Get(ctx, m.key)
+		if err != nil {
+			log.Printf("failed to hash %q: %s", m.key, err)
+			continue
+		}
+		hash, err := perceptualHash(data)
+		if err != nil {
+			log.Printf("failed to hash %q: %s", m.key, err)
+			continue
+		}
+		gameState.Modify(func(gs GameState) GameState {
+			ps, ok := gs.Players[m.player]
+			if !ok {
+				return gs
+			}
+			photo := ps.Board.get(m.x, m.y).photo(m.key)
+			if photo == nil {
+				return gs
+			}
+			photo.Hash = hash
+			for _, similar := range gs.similarPhotos(hash, m.player, m.x, m.y) {
+				photo.SimilarTo = append(photo.SimilarTo, similar.Photo.Key)
+			}
+			gs.Players[m.player] = ps
+			return gs
+		})
+	}
+	if len(todo) > 0 {
+		logf("computed %d missing perceptual hashes", len(todo))
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Photo is an image uploaded for a [BingoSpace].
+type Photo struct {
+	Key      string    `json:"key"` // [BlobStore] key
+	Caption  string    `json:"caption,omitempty"`
+	Uploaded time.Time `json:"at"`
+	Size     int       `json:"size"`            // in bytes, counted towards [maxStoragePerPlayer]
+	Hash     string    `json:"phash,omitempty"` // see [perceptualHash], empty if not computed yet
+	// in pixels as displayed, after applying the EXIF orientation, zero if uploaded before it was recorded
+	Width int `json:"width,omitempty"`
+	// keys of near-duplicates that were already uploaded when this photo was, see [GameState.similarPhotos]
+	SimilarTo []string `json:"similar,omitempty"`
+	// from the EXIF data, zero if unknown
+	Taken   time.Time    `json:"taken,omitempty"`
+	Reports []PlayerName `json:"reports,omitempty"`
+	Hidden  bool         `json:"hidden,omitempty"` // by a moderator, only visible to moderators and the owner
+	// a moderator decided that the photo is fine despite being flagged
+	Dismissed bool `json:"dismissed,omitempty"`
+}
+
+// DisplayPhoto is a denormalized [Photo] for template rendering.
+type DisplayPhoto struct {
+	Key       string
+	Caption   string
+	Uploaded  time.Time
+	Image     string // path relative to [basePath]
+	Thumbnail string
+	Variants  []ImageVariant // resized versions of Image
+	// only filled in by [GameState.displayPhoto]
+	Comments  []DisplayComment
+	Reactions []DisplayReaction
+}
+
+func (photo *Photo) display() DisplayPhoto {
+	return DisplayPhoto{
+		Key:       photo.Key,
+		Caption:   photo.Caption,
+		Uploaded:  photo.Uploaded,
+		Image:     imageURLPath(photo.Key),
+		Thumbnail: imageURLPath(derivativeKey(photo.Key, thumbnailVariant)),
+		Variants:  imageVariants(photo.Key, photo.Width),
+	}
+}
+
+func (space *BingoSpace) photo(key string) *Photo {
+	i := slices.IndexFunc(space.Photos, func(p Photo) bool { return p.Key == key })
+	if i < 0 {
+		return nil
+	}
+	return &space.Photos[i]
+}
+
+// addPhoto adds a new photo to the space, making it the submission if there is none yet.
+// Limits must be checked beforehand using [checkUploadLimits].
+func (space *BingoSpace) addPhoto(photo Photo) {
+	space.Photos = append(space.Photos, photo)
+	if space.Hero == "" {
+		space.Hero = photo.Key
+	}
+}
+
+// removePhoto removes a photo from the space, returning whether it was present.
+// If it was the submission, the oldest remaining photo takes its place.
+func (space *BingoSpace) removePhoto(key string) bool {
+	n := len(space.Photos)
+	space.Photos = slices.DeleteFunc(space.Photos, func(p Photo) bool { return p.Key == key })
+	if space.Hero == key {
+		space.Hero = ""
+		if len(space.Photos) > 0 {
+			space.Hero = space.Photos[0].Key
+		}
+	}
+	return len(space.Photos) != n
+}
+
+// storageUsed returns the total size of all photos on the player's board.
+func (ps *PlayerState) storageUsed() int {
+	res := 0
+	for x := range 5 {
+		for y := range 5 {
+			for _, photo := range ps.Board.get(x, y).Photos {
+				res += photo.Size
+			}
+		}
+	}
+	return res
+}
+
+// checkUpload returns an error if the player may not upload the given photo to the given space,
+// because of the limits or because duplicates are blocked.
+func (gs *GameState) checkUpload(player PlayerName, x, y int, photo Photo) error {
+	ps := gs.Players[player]
+	if n := len(ps.Board.get(x, y).Photos); n >= maxPhotosPerSpace {
+		return fmt.Errorf("at most %d photos per space, delete one first", maxPhotosPerSpace)
+	}
+	if used := ps.storageUsed(); used+photo.Size > maxStoragePerPlayer {
+		return fmt.Errorf("storage limit of %d MB reached, delete some photos first", maxStoragePerPlayer/1024/1024)
+	}
+	if gs.Settings.BlockDuplicates {
+		for _, similar := range gs.similarPhotos(photo.Hash, player, x, y) {
+			if similar.Player == player {
+				return fmt.Errorf("this photo looks like the one you uploaded for %q", similar.Goal.Name)
+			}
+			return errors.New("this photo looks like one uploaded by another player")
+		}
+	}
+	return nil
+}
+
+// PhotoLocation identifies a photo and the space it was uploaded for.
+type PhotoLocation struct {
+	Player  PlayerName
+	X, Y    int
+	GoalIdx int
+	Goal    Goal
+	IsHero  bool // whether it's the photo submitted for the space
+	Photo   Photo
+}
+
+func newPhotoLocation(player PlayerName, x, y int, space *BingoSpace, photo Photo) PhotoLocation {
+	return PhotoLocation{
+		Player:  player,
+		X:       x,
+		Y:       y,
+		GoalIdx: space.GoalIdx,
+		Goal:    space.goal(),
+		IsHero:  space.Hero == photo.Key,
+		Photo:   photo,
+	}
+}
+
+// locatePhoto finds the photo with the given key on any board.
+func (gs *GameState) locatePhoto(key string) (PhotoLocation, bool) {
+	for name, ps := range gs.Players {
+		for x := range 5 {
+			for y := range 5 {
+				space := ps.Board.get(x, y)
+				if photo := space.photo(key); photo != nil {
+					return newPhotoLocation(name, x, y, space, *photo), true
+				}
+			}
+		}
+	}
+	return PhotoLocation{}, false
+}
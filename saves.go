@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// saveScheduler coalesces requests to save the [gameState], so a burst of changes results in a single save.
+// A save happens once there were no further requests for the debounce interval,
+// but at the latest after the maximum delay since the first unsaved request.
+type saveScheduler struct {
+	debounce time.Duration
+	maxDelay time.Duration
+	wake     chan struct{} // signals new requests to run, never blocks as it has room for one
+
+	mu         sync.Mutex
+	stats      SaveStats
+	first      time.Time // of the pending requests, zero if there are none
+	last       time.Time
+	retryAfter time.Time // when the last save failed, don't hammer the storage
+}
+
+// SaveStats show how saving the state is doing.
+type SaveStats struct {
+	Pending     int // requests since the last save started, which will be coalesced into the next one
+	Saves       int
+	Failures    int
+	LastSave    time.Time // when the last successful save finished
+	LastLatency time.Duration
+	MaxLatency  time.Duration
+	LastError   string // of the last failed save, cleared by a successful one
+}
+
+var saves = newSaveScheduler(saveDebounce, saveMaxDelay)
+
+func newSaveScheduler(debounce, maxDelay time.Duration) *saveScheduler {
+	return &saveScheduler{
+		debounce: debounce,
+		maxDelay: maxDelay,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// request marks the state as changed, so it gets saved soon. It never blocks.
+func (s *saveScheduler) request() {
+	now := time.Now()
+	s.mu.Lock()
+	s.stats.Pending++
+	if s.first.IsZero() {
+		s.first = now
+	}
+	s.last = now
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// already woken
+	}
+}
+
+// due returns when the pending requests should be saved, if there are any.
+func (s *saveScheduler) due() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.Pending == 0 {
+		return time.Time{}, false
+	}
+	at := s.last.Add(s.debounce)
+	if deadline := s.first.Add(s.maxDelay); deadline.Before(at) {
+		at = deadline
+	}
+	if at.Before(s.retryAfter) {
+		at = s.retryAfter
+	}
+	return at, true
+}
+
+// run saves the state whenever requested until the context is canceled, and then one last time.
+func (s *saveScheduler) run(ctx context.Context) {
+	timer := time.NewTimer(s.maxDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logf("State saving canceled; performing final save.")
+			// compact when exiting, so the next start doesn't have to replay the journal
+			s.save(true)
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		at, pending := s.due()
+		if !pending {
+			continue
+		}
+		if wait := time.Until(at); wait > 0 {
+			timer.Reset(wait)
+			continue
+		}
+		s.save(false)
+	}
+}
+
+func (s *saveScheduler) save(compact bool) {
+	s.mu.Lock()
+	requests := s.stats.Pending
+	s.stats.Pending = 0
+	s.first = time.Time{}
+	s.mu.Unlock()
+
+	start := time.Now()
+	err := persistChanges(compact)
+	latency := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		log.Printf("failed to save state: %s", err)
+		s.stats.Failures++
+		s.stats.LastError = err.Error()
+		// the changes are still unsaved, so try again later
+		s.stats.Pending += requests
+		if s.first.IsZero() {
+			s.first = start
+		}
+		s.retryAfter = time.Now().Add(s.maxDelay)
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+	s.stats.Saves++
+	s.stats.LastSave = time.Now()
+	s.stats.LastLatency = latency
+	s.stats.MaxLatency = max(s.stats.MaxLatency, latency)
+	s.stats.LastError = ""
+	logf("saved state in %s, coalescing %d requests", latency, requests)
+}
+
+func (s *saveScheduler) Stats() SaveStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Every snapshot written to [latestStatePath] is also kept in [snapshotDir] under a timestamped name,
+// and old ones are thinned out according to [snapshotRetention].
+
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+// SnapshotRetention keeps one snapshot per Bucket for snapshots younger than For.
+type SnapshotRetention struct {
+	Bucket time.Duration
+	For    time.Duration
+}
+
+// Snapshot is a timestamped copy of the game state in [snapshotDir].
+type Snapshot struct {
+	Name string // file name
+	Time time.Time
+	Size int64
+}
+
+func snapshotName(t time.Time) string {
+	return "state-" + t.UTC().Format(snapshotTimeFormat) + ".json"
+}
+
+func parseSnapshotName(name string) (time.Time, bool) {
+	ts, ok := strings.CutPrefix(name, "state-")
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, ok = strings.CutSuffix(ts, ".json")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(snapshotTimeFormat, ts)
+	return t, err == nil
+}
+
+// listSnapshots returns the snapshots in [snapshotDir], newest first.
+func listSnapshots() ([]Snapshot, error) {
+	entries, err := os.ReadDir(snapshotDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("listing snapshots: %w", err)
+	}
+	var res []Snapshot
+	for _, e := range entries {
+		t, ok := parseSnapshotName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// deleted in the meantime
+			continue
+		}
+		res = append(res, Snapshot{Name: e.Name(), Time: t, Size: info.Size()})
+	}
+	slices.SortFunc(res, func(a, b Snapshot) int {
+		return b.Time.Compare(a.Time)
+	})
+	return res, nil
+}
+
+// keepSnapshot adds the just written [latestStatePath] to the snapshots and removes those no longer retained.
+func keepSnapshot(now time.Time) error {
+	if err := os.MkdirAll(snapshotDir, 0700); err != nil {
+		return fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	// a hard link is cheap, and unaffected by the latest state being replaced later
+	path := filepath.Join(snapshotDir, snapshotName(now))
+	if err := os.Link(latestStatePath, path); err != nil {
+		return fmt.Errorf("creating snapshot %q: %w", path, err)
+	}
+	snapshots, err := listSnapshots()
+	if err != nil {
+		return err
+	}
+	for _, s := range expiredSnapshots(snapshots, now) {
+		if err := os.Remove(filepath.Join(snapshotDir, s.Name)); err != nil {
+			log.Printf("failed to remove expired snapshot %q: %s", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// expiredSnapshots returns the snapshots (sorted newest first) no longer covered by [snapshotRetention].
+// Within each retention bucket, only the newest snapshot is kept, and the newest snapshot overall is always kept.
+func expiredSnapshots(snapshots []Snapshot, now time.Time) []Snapshot {
+	type bucket struct {
+		tier  int
+		start time.Time
+	}
+	seen := map[bucket]bool{}
+	var res []Snapshot
+	for i, s := range snapshots {
+		if i == 0 {
+			continue
+		}
+		age := now.Sub(s.Time)
+		tier := slices.IndexFunc(snapshotRetention, func(r SnapshotRetention) bool { return age < r.For })
+		if tier < 0 {
+			res = append(res, s)
+			continue
+		}
+		b := bucket{tier, s.Time.Truncate(snapshotRetention[tier].Bucket)}
+		if seen[b] {
+			res = append(res, s)
+			continue
+		}
+		seen[b] = true
+	}
+	return res
+}
+
+// errSnapshotsNotKept is returned when the [store] doesn't keep snapshots, like [SQLiteStateStore].
+var errSnapshotsNotKept = errors.New("snapshots are only kept when storing the game in JSON files, back up the database instead")
+
+// snapshotsKept reports whether the [store] keeps snapshots in [snapshotDir].
+func snapshotsKept() bool {
+	_, ok := store.(*JSONFileStore)
+	return ok
+}
+
+// restoreSnapshot replaces the game state with the given snapshot.
+// The state being replaced is persisted as a snapshot first, so the restore can be undone.
+func restoreSnapshot(name string, actor PlayerName, now time.Time) error {
+	if !snapshotsKept() {
+		return errSnapshotsNotKept
+	}
+	if _, ok := parseSnapshotName(name); !ok || filepath.Base(name) != name {
+		return fmt.Errorf("invalid snapshot name %q", name)
+	}
+	restored, err := readSnapshot(filepath.Join(snapshotDir, name))
+	if err != nil {
+		return err
+	}
+	if err := migrateState(&restored); err != nil {
+		return fmt.Errorf("snapshot %q: %w", name, err)
+	}
+	if err := writeState(); err != nil {
+		return fmt.Errorf("saving current state before restoring: %w", err)
+	}
+	gameState.Modify(func(gs GameState) GameState {
+		restored.audit(AuditEntry{At: now, Actor: actor, Action: "restore", Target: name})
+		return restored
+	})
+	if err := writeState(); err != nil {
+		return fmt.Errorf("saving restored state: %w", err)
+	}
+	log.Printf("restored snapshot %q", name)
+	return nil
+}
+
+type SnapshotsData struct {
+	BaseURL   string
+	Kept      bool // see [snapshotsKept]
+	Snapshots []Snapshot
+	Saving    SaveStats
+}
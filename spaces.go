@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusError is an error with the HTTP status it should be served with.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e statusError) Error() string { return e.err.Error() }
+func (e statusError) Unwrap() error { return e.err }
+
+// errorStatus returns the status of a [statusError] in err's chain, or the fallback.
+func errorStatus(err error, fallback int) int {
+	var se statusError
+	if errors.As(err, &se) {
+		return se.status
+	}
+	return fallback
+}
+
+// parseSpace returns the coordinates of the space in the request path.
+func parseSpace(r *http.Request) (x, y int, err error) {
+	x, err = strconv.Atoi(r.PathValue("x"))
+	if err != nil || x < 0 || x >= 5 {
+		return 0, 0, errors.New("invalid X value")
+	}
+	y, err = strconv.Atoi(r.PathValue("y"))
+	if err != nil || y < 0 || y >= 5 {
+		return 0, 0, errors.New("invalid Y value")
+	}
+	return x, y, nil
+}
+
+// readUpload returns the contents of the image_file in a multipart form.
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			return nil, statusError{http.StatusRequestEntityTooLarge, fmt.Errorf("upload too large, limit %d MB", maxUploadSize/1024/1024)}
+		}
+		return nil, err
+	}
+	srcFile, _, err := r.FormFile("image_file")
+	if err != nil {
+		return nil, err
+	}
+	defer srcFile.Close()
+	srcData, err := io.ReadAll(srcFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file upload: %w", err)
+	}
+	if err = srcFile.Close(); err != nil {
+		return nil, statusError{http.StatusInternalServerError, fmt.Errorf("failed to close file upload: %w", err)}
+	}
+	return srcData, nil
+}
+
+// storeUpload normalizes an uploaded image for the given space and puts it into the [BlobStore].
+// The returned photo still has to be added by a [SpaceAction].
+// Errors are the client's fault unless they're a [statusError].
+func storeUpload(ctx context.Context, user PlayerName, x, y int, srcData []byte, caption string) (Photo, error) {
+	if len(caption) > maxCaptionLength {
+		return Photo{}, fmt.Errorf("caption too long, limit %d characters", maxCaptionLength)
+	}
+	imageData, err := normalizeImage(srcData)
+	if err != nil {
+		return Photo{}, err
+	}
+	// random keys reveal neither the owner nor other uploads
+	randKey, err := randStr(12)
+	if err != nil {
+		return Photo{}, statusError{http.StatusInternalServerError, fmt.Errorf("generating file name: %w", err)}
+	}
+	hash, err := perceptualHash(imageData)
+	if err != nil {
+		return Photo{}, fmt.Errorf("failed to hash image: %w", err)
+	}
+	upload := Photo{
+		Key:      randKey + ".jpg",
+		Caption:  caption,
+		Uploaded: time.Now(),
+		Size:     len(imageData),
+		Hash:     hash,
+		Width:    orientedWidth(imageData),
+		Taken:    jpegDateTaken(srcData),
+	}
+	gameState.Read(func(gs GameState) {
+		err = gs.checkUpload(user, x, y, upload)
+	})
+	if err != nil {
+		return Photo{}, err
+	}
+	if err := blobs.Put(ctx, upload.Key, imageData, "image/jpeg"); err != nil {
+		return Photo{}, statusError{http.StatusInternalServerError, fmt.Errorf("failed to store file: %w", err)}
+	}
+	if err = generateDerivatives(ctx, upload.Key); err != nil {
+		// not fatal, they will be regenerated on demand
+		logf("failed to generate resized images: %s", err)
+	}
+	return upload, nil
+}
+
+// SpaceAction is a change players make to a space on their own board.
+type SpaceAction struct {
+	Action  string // complete, decomplete, upload, hero, caption or delete-photo
+	Photo   string // key of the photo for hero, caption and delete-photo
+	Caption string // the new caption
+	Upload  Photo  // the photo to add, see [storeUpload]
+}
+
+// performSpaceAction applies the action to the user's space, or leaves the state untouched on error.
+// A failed upload is discarded.
+func performSpaceAction(user PlayerName, x, y int, a SpaceAction) error {
+	now := time.Now()
+	err := gameState.ModifyE(func(gs GameState) (GameState, error) {
+		err := gs.applySpaceAction(user, x, y, a, now)
+		return gs, err
+	})
+	if err != nil && a.Action == "upload" {
+		// the upload was stored already
+		gameState.Modify(func(gs GameState) GameState {
+			gs.discardImage(a.Upload.Key, now)
+			return gs
+		})
+	}
+	return err
+}
+
+func (gs *GameState) applySpaceAction(user PlayerName, x, y int, a SpaceAction, now time.Time) error {
+	pd := gs.Players[user]
+	space := pd.Board.get(x, y)
+	if err := gs.spaceLock(space); err != nil {
+		return err
+	}
+	entry := AuditEntry{At: now, Actor: user, Action: a.Action, Player: user, Target: spaceTarget(x, y, space)}
+	switch a.Action {
+	case "complete":
+		if gs.Settings.photoRequired() && space.Hero == "" {
+			return errors.New("upload a photo to complete this space")
+		}
+		entry.Before, entry.After = strconv.FormatBool(space.Completed), "true"
+		space.Completed = true
+	case "decomplete":
+		// the photos stay, they can be deleted one by one
+		entry.Before, entry.After = strconv.FormatBool(space.Completed), "false"
+		space.Completed = false
+	case "upload":
+		upload := a.Upload
+		if err := gs.checkUpload(user, x, y, upload); err != nil {
+			// another upload got in first
+			return err
+		}
+		for _, similar := range gs.similarPhotos(upload.Hash, user, x, y) {
+			upload.SimilarTo = append(upload.SimilarTo, similar.Photo.Key)
+		}
+		entry.After, entry.Detail = upload.Key, upload.Caption
+		space.addPhoto(upload)
+		space.Completed = true
+	case "hero":
+		if space.photo(a.Photo) == nil {
+			return fmt.Errorf("no photo %q on this space", a.Photo)
+		}
+		entry.Before, entry.After = space.Hero, a.Photo
+		space.Hero = a.Photo
+	case "caption":
+		photo := space.photo(a.Photo)
+		if photo == nil {
+			return fmt.Errorf("no photo %q on this space", a.Photo)
+		}
+		if len(a.Caption) > maxCaptionLength {
+			return fmt.Errorf("caption too long, limit %d characters", maxCaptionLength)
+		}
+		entry.Before, entry.After, entry.Detail = photo.Caption, a.Caption, a.Photo
+		photo.Caption = a.Caption
+	case "delete-photo":
+		if !space.removePhoto(a.Photo) {
+			return fmt.Errorf("no photo %q on this space", a.Photo)
+		}
+		entry.Before = a.Photo
+		gs.discardImage(a.Photo, now)
+		if gs.Settings.photoRequired() && len(space.Photos) == 0 {
+			space.Completed = false
+		}
+	default:
+		return fmt.Errorf("unknown action %q", a.Action)
+	}
+	gs.Players[user] = pd
+	gs.audit(entry)
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockState does nothing where flock isn't available, the server must be stopped before running commands.
+func lockState() (*os.File, error) {
+	return nil, nil
+}
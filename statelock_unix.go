@@ -0,0 +1,26 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockState takes the exclusive lock on [stateLockPath], which is released when the process exits.
+func lockState() (*os.File, error) {
+	f, err := os.OpenFile(stateLockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%s is locked by another process, stop the server before running commands", stateLockPath)
+		}
+		return nil, fmt.Errorf("locking %s: %w", stateLockPath, err)
+	}
+	return f, nil
+}
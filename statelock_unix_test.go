@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLockStateIsExclusive(t *testing.T) {
+	inTempDir(t)
+	server, err := lockState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockState(); err == nil || !strings.Contains(err.Error(), "stop the server") {
+		t.Errorf("locking the state twice: got error %v, want it to be refused", err)
+	}
+	server.Close()
+	command, err := lockState()
+	if err != nil {
+		t.Fatalf("locking the state after the server stopped: %s", err)
+	}
+	command.Close()
+}
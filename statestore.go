@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateStore persists the game state.
+type StateStore interface {
+	// Load returns the persisted state, which is empty if nothing has been persisted yet.
+	Load() (GameState, error)
+	// WantsSnapshot reports whether the next Save should include the complete state,
+	// given whether a snapshot was requested and whether there are any changes.
+	WantsSnapshot(requested bool, changed bool, now time.Time) bool
+	// Save persists the changes since the last successful Save, or since Load.
+	// The snapshot is the JSON of the complete state if [StateStore.WantsSnapshot] asked for it, nil otherwise.
+	// If Save fails, the next call contains the same changes again, plus any made in the meantime.
+	Save(changes []stateChange, snapshot []byte, now time.Time) error
+	Close() error
+}
+
+// newStateStoreFromEnv uses the SQLite database at PHOTO_BINGO_SQLITE if set, otherwise [latestStatePath].
+func newStateStoreFromEnv() (StateStore, error) {
+	if path := os.Getenv("PHOTO_BINGO_SQLITE"); path != "" {
+		return openSQLiteStateStore(path)
+	}
+	return &JSONFileStore{}, nil
+}
+
+// JSONFileStore keeps the state as a snapshot in [latestStatePath] plus a [stateJournal] of the changes since.
+type JSONFileStore struct {
+	journal stateJournal
+}
+
+var _ StateStore = (*JSONFileStore)(nil)
+
+// Load reads the snapshot in [latestStatePath] and replays the journal on top of it.
+// If it has to fall back to a backup, the journal is quarantined instead, as its changes are relative to the latest snapshot.
+func (s *JSONFileStore) Load() (GameState, error) {
+	var loadedState GameState
+	// fall back to the newest valid backup, though the journal only applies to the latest snapshot
+	candidates := []string{latestStatePath, previousStatePath}
+	snapshots, err := listSnapshots()
+	if err != nil {
+		log.Printf("failed to list snapshots: %s", err)
+	}
+	for _, s := range snapshots {
+		candidates = append(candidates, filepath.Join(snapshotDir, s.Name))
+	}
+	var errs []error
+	loadedFrom := ""
+	for _, path := range candidates {
+		state, err := readSnapshot(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		loadedState, loadedFrom = state, path
+		break
+	}
+	switch {
+	case loadedFrom == "" && !allNotExist(errs):
+		return loadedState, fmt.Errorf("no valid state file: %w", errors.Join(errs...))
+	case loadedFrom == "":
+		// no snapshot on first launch, though there may already be a journal
+	case len(errs) > 0:
+		log.Printf("WARNING: using backup %q, changes since are lost: %s", loadedFrom, errors.Join(errs...))
+	}
+	if loadedFrom == latestStatePath {
+		if info, err := os.Stat(latestStatePath); err == nil {
+			s.journal.snapshotAt = info.ModTime()
+		}
+	}
+	if loadedFrom == latestStatePath || loadedFrom == "" {
+		if err := s.journal.replay(&loadedState); err != nil {
+			return loadedState, err
+		}
+	} else if err := s.journal.quarantine(time.Now()); err != nil {
+		return loadedState, err
+	}
+	if err := s.journal.open(); err != nil {
+		return loadedState, err
+	}
+	if loadedFrom != "" {
+		logf("game state loaded from %q", loadedFrom)
+	}
+	return loadedState, nil
+}
+
+// WantsSnapshot compacts the journal once it has grown too long or the last snapshot is too old.
+// If the snapshot is up to date already, there's no need for another one.
+func (s *JSONFileStore) WantsSnapshot(requested bool, changed bool, now time.Time) bool {
+	dirty := changed || s.journal.records > 0
+	return dirty && (requested || s.journal.records >= maxJournalRecords || now.Sub(s.journal.snapshotAt) >= snapshotInterval)
+}
+
+// Save appends the changes to the journal, and if given a snapshot, writes it and empties the journal.
+func (s *JSONFileStore) Save(changes []stateChange, snapshot []byte, now time.Time) error {
+	// even when compacting, the journal has to be complete in case of a crash before it is emptied,
+	// as replaying it on top of the new snapshot then must not revert any changes
+	if len(changes) > 0 {
+		if err := s.journal.append(changes, now); err != nil {
+			return err
+		}
+		logf("journaled %d changes to %q", len(changes), journalPath)
+	}
+	if snapshot == nil {
+		return nil
+	}
+	if err := writeSnapshot(snapshot); err != nil {
+		return err
+	}
+	logf("state successfully saved to %q", latestStatePath)
+	s.journal.snapshotAt = now
+	if err := keepSnapshot(now); err != nil {
+		// the latest state is safe, only history is missing
+		log.Printf("failed to keep snapshot: %s", err)
+	}
+	return s.journal.reset()
+}
+
+func (s *JSONFileStore) Close() error {
+	return s.journal.close()
+}
+
+func allNotExist(errs []error) bool {
+	for _, err := range errs {
+		if !errors.Is(err, os.ErrNotExist) {
+			return false
+		}
+	}
+	return true
+}
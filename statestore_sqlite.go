@@ -0,0 +1,576 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStateStore keeps the state in an SQLite database, with tables for the players and their boards and photos.
+// Parts of the state without a table of their own, like [GameState.Version], are stored as JSON in state_entries and state_items.
+type SQLiteStateStore struct {
+	db *sql.DB
+}
+
+var _ StateStore = (*SQLiteStateStore)(nil)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS games (
+	id       INTEGER PRIMARY KEY CHECK (id = 1), -- there is only a single game
+	settings TEXT NOT NULL                       -- JSON of GameSettings
+);
+CREATE TABLE IF NOT EXISTS players (
+	name      TEXT PRIMARY KEY,
+	password  TEXT NOT NULL,
+	approved  INTEGER NOT NULL,
+	moderator INTEGER NOT NULL,
+	team      TEXT NOT NULL,
+	suspended INTEGER NOT NULL
+);
+-- the browsers each player signed up or voted from, see deviceID
+CREATE TABLE IF NOT EXISTS devices (
+	player   TEXT NOT NULL REFERENCES players (name) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	device   TEXT NOT NULL,
+	PRIMARY KEY (player, position)
+);
+CREATE TABLE IF NOT EXISTS spaces (
+	player    TEXT NOT NULL REFERENCES players (name) ON DELETE CASCADE,
+	x         INTEGER NOT NULL CHECK (x BETWEEN 0 AND 4),
+	y         INTEGER NOT NULL CHECK (y BETWEEN 0 AND 4),
+	goal      INTEGER NOT NULL,
+	completed INTEGER NOT NULL,
+	hero      TEXT NOT NULL,
+	review    TEXT, -- JSON of Review
+	PRIMARY KEY (player, x, y)
+);
+CREATE TABLE IF NOT EXISTS photos (
+	player    TEXT NOT NULL,
+	x         INTEGER NOT NULL,
+	y         INTEGER NOT NULL,
+	position  INTEGER NOT NULL,
+	key       TEXT NOT NULL,
+	caption   TEXT NOT NULL,
+	uploaded  TEXT,
+	size      INTEGER NOT NULL,
+	phash     TEXT NOT NULL,
+	width     INTEGER NOT NULL DEFAULT 0,
+	similar   TEXT, -- JSON array of keys
+	taken     TEXT,
+	reports   TEXT, -- JSON array of player names
+	hidden    INTEGER NOT NULL,
+	dismissed INTEGER NOT NULL,
+	PRIMARY KEY (player, x, y, position),
+	FOREIGN KEY (player, x, y) REFERENCES spaces (player, x, y) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS photos_key ON photos (key);
+-- entries of the other map fields of GameState, and other top-level fields under an empty key
+CREATE TABLE IF NOT EXISTS state_entries (
+	field TEXT NOT NULL,
+	key   TEXT NOT NULL,
+	value TEXT NOT NULL, -- JSON
+	PRIMARY KEY (field, key)
+);
+-- elements of the slice fields of GameState
+CREATE TABLE IF NOT EXISTS state_items (
+	field TEXT NOT NULL,
+	idx   INTEGER NOT NULL,
+	value TEXT NOT NULL, -- JSON
+	PRIMARY KEY (field, idx)
+);
+`
+
+func openSQLiteStateStore(path string) (*SQLiteStateStore, error) {
+	// the pragmas have to be applied to every connection of the pool
+	dsn := "file:" + path + "?" + url.Values{"_pragma": {
+		"foreign_keys(1)",
+		"journal_mode(WAL)",
+		"synchronous(FULL)",
+		"busy_timeout(5000)",
+	}}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening database %q: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating tables in %q: %w", path, err)
+	}
+	logf("using database %q", path)
+	return &SQLiteStateStore{db: db}, nil
+}
+
+func (s *SQLiteStateStore) Load() (GameState, error) {
+	var gs GameState
+	var settings string
+	err := s.db.QueryRow(`SELECT settings FROM games WHERE id = 1`).Scan(&settings)
+	if err == nil {
+		err = json.Unmarshal([]byte(settings), &gs.Settings)
+	} else if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	if err != nil {
+		return gs, fmt.Errorf("loading settings: %w", err)
+	}
+	players, err := loadSQLitePlayers(s.db, nil)
+	if err != nil {
+		return gs, fmt.Errorf("loading players: %w", err)
+	}
+	if len(players) > 0 {
+		gs.Players = players
+	}
+	if err := s.loadEntries(&gs); err != nil {
+		return gs, err
+	}
+	if err := s.loadItems(&gs); err != nil {
+		return gs, err
+	}
+	return gs, nil
+}
+
+// sqlQuerier is either a [sql.DB] or a [sql.Tx].
+type sqlQuerier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadSQLitePlayers loads all players, or only the given one.
+func loadSQLitePlayers(q sqlQuerier, only *PlayerName) (map[PlayerName]PlayerState, error) {
+	query := func(columns, table, nameColumn, order string) (*sql.Rows, error) {
+		if only == nil {
+			return q.Query(`SELECT ` + columns + ` FROM ` + table + order)
+		}
+		return q.Query(`SELECT `+columns+` FROM `+table+` WHERE `+nameColumn+` = ?`+order, *only)
+	}
+	players := map[PlayerName]PlayerState{}
+
+	rows, err := query(`name, password, approved, moderator, team, suspended`, `players`, `name`, ``)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name PlayerName
+			ps   PlayerState
+		)
+		if err := rows.Scan(&name, &ps.Password, &ps.Approved, &ps.Moderator, &ps.Team, &ps.Suspended); err != nil {
+			return nil, err
+		}
+		players[name] = ps
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = query(`player, device`, `devices`, `player`, ` ORDER BY player, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name   PlayerName
+			device string
+		)
+		if err := rows.Scan(&name, &device); err != nil {
+			return nil, err
+		}
+		ps := players[name]
+		ps.Devices = append(ps.Devices, device)
+		players[name] = ps
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = query(`player, x, y, goal, completed, hero, review`, `spaces`, `player`, ``)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name   PlayerName
+			x, y   int
+			space  BingoSpace
+			review sql.NullString
+		)
+		if err := rows.Scan(&name, &x, &y, &space.GoalIdx, &space.Completed, &space.Hero, &review); err != nil {
+			return nil, err
+		}
+		if review.Valid {
+			space.Review = &Review{}
+			if err := json.Unmarshal([]byte(review.String), space.Review); err != nil {
+				return nil, fmt.Errorf("review of space %d/%d of %q: %w", x, y, name, err)
+			}
+		}
+		ps := players[name]
+		*ps.Board.get(x, y) = space
+		players[name] = ps
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = query(`player, x, y, key, caption, uploaded, size, phash, width, similar, taken, reports, hidden, dismissed`,
+		`photos`, `player`, ` ORDER BY player, x, y, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name             PlayerName
+			x, y             int
+			photo            Photo
+			uploaded, taken  sql.NullString
+			similar, reports sql.NullString
+		)
+		err := rows.Scan(&name, &x, &y, &photo.Key, &photo.Caption, &uploaded, &photo.Size, &photo.Hash, &photo.Width,
+			&similar, &taken, &reports, &photo.Hidden, &photo.Dismissed)
+		if err != nil {
+			return nil, err
+		}
+		if photo.Uploaded, err = parseSQLTime(uploaded); err != nil {
+			return nil, fmt.Errorf("photo %q: %w", photo.Key, err)
+		}
+		if photo.Taken, err = parseSQLTime(taken); err != nil {
+			return nil, fmt.Errorf("photo %q: %w", photo.Key, err)
+		}
+		if err := unmarshalSQLJSON(similar, &photo.SimilarTo); err != nil {
+			return nil, fmt.Errorf("photo %q: %w", photo.Key, err)
+		}
+		if err := unmarshalSQLJSON(reports, &photo.Reports); err != nil {
+			return nil, fmt.Errorf("photo %q: %w", photo.Key, err)
+		}
+		ps := players[name]
+		space := ps.Board.get(x, y)
+		space.Photos = append(space.Photos, photo)
+		players[name] = ps
+	}
+	return players, rows.Err()
+}
+
+func (s *SQLiteStateStore) loadEntries(gs *GameState) error {
+	rows, err := s.db.Query(`SELECT field, key, value FROM state_entries`)
+	if err != nil {
+		return fmt.Errorf("loading entries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var field, key, value string
+		if err := rows.Scan(&field, &key, &value); err != nil {
+			return fmt.Errorf("loading entries: %w", err)
+		}
+		if err := gs.apply(stateChange{Field: field, Key: key, Value: json.RawMessage(value)}); err != nil {
+			return fmt.Errorf("loading entries: %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStateStore) loadItems(gs *GameState) error {
+	rows, err := s.db.Query(`SELECT field, value FROM state_items ORDER BY field, idx`)
+	if err != nil {
+		return fmt.Errorf("loading items: %w", err)
+	}
+	defer rows.Close()
+	items := map[string][]json.RawMessage{}
+	for rows.Next() {
+		var field, value string
+		if err := rows.Scan(&field, &value); err != nil {
+			return fmt.Errorf("loading items: %w", err)
+		}
+		items[field] = append(items[field], json.RawMessage(value))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading items: %w", err)
+	}
+	for field, values := range items {
+		value, err := json.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", field, err)
+		}
+		if err := gs.apply(stateChange{Field: field, Value: value}); err != nil {
+			return fmt.Errorf("loading items: %w", err)
+		}
+	}
+	return nil
+}
+
+// WantsSnapshot always declines, every Save updates the tables in place.
+func (s *SQLiteStateStore) WantsSnapshot(requested bool, changed bool, now time.Time) bool {
+	return false
+}
+
+// Save applies the changes in a single transaction.
+func (s *SQLiteStateStore) Save(changes []stateChange, snapshot []byte, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback() // fails harmlessly after commit
+	for _, c := range changes {
+		if err := saveSQLiteChange(tx, c); err != nil {
+			return fmt.Errorf("saving %s: %w", c.Field, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	logf("saved %d changes to the database", len(changes))
+	return nil
+}
+
+func saveSQLiteChange(tx *sql.Tx, c stateChange) error {
+	switch c.Field {
+	case "Players":
+		name := PlayerName(c.Key)
+		if c.Delete {
+			// deletes cascade to the board
+			_, err := tx.Exec(`DELETE FROM players WHERE name = ?`, name)
+			return err
+		}
+		var ps PlayerState
+		if err := json.Unmarshal(c.Value, &ps); err != nil {
+			return err
+		}
+		return updateSQLitePlayer(tx, name, &ps)
+	case "Settings":
+		_, err := tx.Exec(`INSERT INTO games (id, settings) VALUES (1, ?)
+			ON CONFLICT (id) DO UPDATE SET settings = excluded.settings`, string(c.Value))
+		return err
+	}
+	field, ok := reflect.TypeOf(GameState{}).FieldByName(c.Field)
+	if !ok {
+		return fmt.Errorf("unknown field %q", c.Field)
+	}
+	switch field.Type.Kind() {
+	case reflect.Map:
+		if c.Delete {
+			_, err := tx.Exec(`DELETE FROM state_entries WHERE field = ? AND key = ?`, c.Field, c.Key)
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO state_entries (field, key, value) VALUES (?, ?, ?)
+			ON CONFLICT (field, key) DO UPDATE SET value = excluded.value`, c.Field, c.Key, string(c.Value))
+		return err
+	case reflect.Slice:
+		var tail []json.RawMessage
+		if err := json.Unmarshal(c.Value, &tail); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM state_items WHERE field = ? AND idx >= ?`, c.Field, c.Index); err != nil {
+			return err
+		}
+		for i, value := range tail {
+			_, err := tx.Exec(`INSERT INTO state_items (field, idx, value) VALUES (?, ?, ?)`, c.Field, c.Index+i, string(value))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		_, err := tx.Exec(`INSERT INTO state_entries (field, key, value) VALUES (?, '', ?)
+			ON CONFLICT (field, key) DO UPDATE SET value = excluded.value`, c.Field, string(c.Value))
+		return err
+	}
+}
+
+// updateSQLitePlayer writes only the rows of the player that differ from what's in the database.
+func updateSQLitePlayer(tx *sql.Tx, name PlayerName, ps *PlayerState) error {
+	stored, err := loadSQLitePlayers(tx, &name)
+	if err != nil {
+		return fmt.Errorf("loading stored player: %w", err)
+	}
+	old, exists := stored[name]
+	if !exists {
+		_, err := tx.Exec(`INSERT INTO players (name, password, approved, moderator, team, suspended) VALUES (?, ?, ?, ?, ?, ?)`,
+			append([]any{name}, sqlitePlayerRow(ps)...)...)
+		if err != nil {
+			return err
+		}
+	} else if !slices.Equal(sqlitePlayerRow(&old), sqlitePlayerRow(ps)) {
+		_, err := tx.Exec(`UPDATE players SET password = ?, approved = ?, moderator = ?, team = ?, suspended = ? WHERE name = ?`,
+			append(sqlitePlayerRow(ps), name)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// devices are only ever added, so usually only the new ones are written
+	common := 0
+	for common < min(len(old.Devices), len(ps.Devices)) && old.Devices[common] == ps.Devices[common] {
+		common++
+	}
+	if common < len(old.Devices) {
+		if _, err := tx.Exec(`DELETE FROM devices WHERE player = ? AND position >= ?`, name, common); err != nil {
+			return err
+		}
+	}
+	for i := common; i < len(ps.Devices); i++ {
+		if _, err := tx.Exec(`INSERT INTO devices (player, position, device) VALUES (?, ?, ?)`, name, i, ps.Devices[i]); err != nil {
+			return err
+		}
+	}
+
+	for x := range 5 {
+		for y := range 5 {
+			oldSpace, space := old.Board.get(x, y), ps.Board.get(x, y)
+			if err := updateSQLiteSpace(tx, name, x, y, exists, oldSpace, space); err != nil {
+				return fmt.Errorf("space %d/%d: %w", x, y, err)
+			}
+		}
+	}
+	return nil
+}
+
+func updateSQLiteSpace(tx *sql.Tx, name PlayerName, x, y int, exists bool, old, space *BingoSpace) error {
+	oldRow, err := sqliteSpaceRow(old)
+	if err != nil {
+		return err
+	}
+	row, err := sqliteSpaceRow(space)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = tx.Exec(`INSERT INTO spaces (player, x, y, goal, completed, hero, review) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			append([]any{name, x, y}, row...)...)
+	} else if !slices.Equal(oldRow, row) {
+		_, err = tx.Exec(`UPDATE spaces SET goal = ?, completed = ?, hero = ?, review = ? WHERE player = ? AND x = ? AND y = ?`,
+			append(row, name, x, y)...)
+	}
+	if err != nil {
+		return err
+	}
+	if len(old.Photos) > len(space.Photos) {
+		_, err := tx.Exec(`DELETE FROM photos WHERE player = ? AND x = ? AND y = ? AND position >= ?`, name, x, y, len(space.Photos))
+		if err != nil {
+			return err
+		}
+	}
+	for i := range space.Photos {
+		row, err := sqlitePhotoRow(&space.Photos[i])
+		if err != nil {
+			return err
+		}
+		if i < len(old.Photos) {
+			oldRow, err := sqlitePhotoRow(&old.Photos[i])
+			if err != nil {
+				return err
+			}
+			if slices.Equal(oldRow, row) {
+				continue
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO photos (player, x, y, position, key, caption, uploaded, size, phash, width, similar, taken, reports, hidden, dismissed)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (player, x, y, position) DO UPDATE SET key = excluded.key, caption = excluded.caption,
+				uploaded = excluded.uploaded, size = excluded.size, phash = excluded.phash, width = excluded.width, similar = excluded.similar,
+				taken = excluded.taken, reports = excluded.reports, hidden = excluded.hidden, dismissed = excluded.dismissed`,
+			append([]any{name, x, y, i}, row...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlitePlayerRow returns the columns of the players table after the name.
+func sqlitePlayerRow(ps *PlayerState) []any {
+	return []any{ps.Password, ps.Approved, ps.Moderator, ps.Team, ps.Suspended}
+}
+
+// sqliteSpaceRow returns the columns of the spaces table after the coordinates.
+func sqliteSpaceRow(space *BingoSpace) ([]any, error) {
+	review, err := marshalSQLJSON(space.Review != nil, space.Review)
+	if err != nil {
+		return nil, err
+	}
+	return []any{space.GoalIdx, space.Completed, space.Hero, review}, nil
+}
+
+// sqlitePhotoRow returns the columns of the photos table after the position.
+func sqlitePhotoRow(photo *Photo) ([]any, error) {
+	similar, err := marshalSQLJSON(len(photo.SimilarTo) > 0, photo.SimilarTo)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := marshalSQLJSON(len(photo.Reports) > 0, photo.Reports)
+	if err != nil {
+		return nil, err
+	}
+	return []any{photo.Key, photo.Caption, sqlTime(photo.Uploaded), photo.Size, photo.Hash, photo.Width,
+		similar, sqlTime(photo.Taken), reports, photo.Hidden, photo.Dismissed}, nil
+}
+
+func (s *SQLiteStateStore) Close() error {
+	return s.db.Close()
+}
+
+// sqlTime stores zero times as NULL.
+func sqlTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseSQLTime(s sql.NullString) (time.Time, error) {
+	if !s.Valid {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s.String)
+}
+
+// marshalSQLJSON returns the JSON of v if present, or NULL.
+func marshalSQLJSON(present bool, v any) (any, error) {
+	if !present {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func unmarshalSQLJSON(s sql.NullString, v any) error {
+	if !s.Valid {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.String), v)
+}
+
+// migrateToSQLite copies the game state into a new SQLite database.
+func migrateToSQLite(path string) error {
+	s, err := openSQLiteStateStore(path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	var empty bool
+	err = s.db.QueryRow(`SELECT NOT EXISTS (SELECT 1 FROM games) AND NOT EXISTS (SELECT 1 FROM players)
+		AND NOT EXISTS (SELECT 1 FROM state_entries) AND NOT EXISTS (SELECT 1 FROM state_items)`).Scan(&empty)
+	if err != nil {
+		return fmt.Errorf("checking database %q: %w", path, err)
+	}
+	if !empty {
+		return fmt.Errorf("database %q already contains a game", path)
+	}
+	var changes []stateChange
+	gameState.Read(func(gs GameState) {
+		changes, _, err = stateShadow{}.diff(&gs)
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling game state: %w", err)
+	}
+	return s.Save(changes, nil, time.Now())
+}
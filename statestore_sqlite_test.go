@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testGameState() GameState {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	gs := GameState{
+		Version: currentStateVersion(),
+		Players: map[PlayerName]PlayerState{
+			"alice": {Password: "a", Approved: true, Moderator: true, Devices: []string{"d1", "d2"}},
+			"bob":   {Password: "b", Team: "blue", Suspended: true},
+		},
+		Settings: GameSettings{Completion: CompleteVerified, Verification: VerifyPeers, RequiredApprovals: 1, Start: at},
+		Comments: map[string][]Comment{"p1.jpg": {{ID: "c1", Author: "bob", Text: "nice", At: at}}},
+		Notifications: map[PlayerName][]Notification{
+			"alice": {{At: at, From: "bob", Photo: "p1.jpg", Comment: "c1"}},
+		},
+		DiscardedImages: map[string]time.Time{"old.jpg": at},
+		AuditLog:        []AuditEntry{{At: at, Actor: "alice", Action: "upload", Player: "alice", After: "p1.jpg"}},
+	}
+	alice := gs.Players["alice"]
+	space := alice.Board.get(1, 2)
+	space.GoalIdx, space.Completed, space.Hero = 7, true, "p1.jpg"
+	space.Photos = []Photo{
+		{Key: "p1.jpg", Caption: "first", Uploaded: at, Size: 100, Hash: "ff", Width: 640, Taken: at.Add(-time.Hour)},
+		{Key: "p2.jpg", Uploaded: at, Size: 200, SimilarTo: []string{"p1.jpg"}, Reports: []PlayerName{"bob"}, Hidden: true},
+	}
+	space.Review = &Review{Photo: "p1.jpg", Status: ReviewApproved, Approvals: []PlayerName{"bob"}}
+	alice.Board.get(2, 2).GoalIdx = freeGoalIdx
+	gs.Players["alice"] = alice
+	return gs
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMigrateToSQLiteRoundTrip(t *testing.T) {
+	want := testGameState()
+	gameState.Modify(func(GameState) GameState { return want })
+	t.Cleanup(func() { gameState.Modify(func(GameState) GameState { return GameState{} }) })
+
+	path := filepath.Join(t.TempDir(), "game.db")
+	if err := migrateToSQLite(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateToSQLite(path); err == nil {
+		t.Error("migrating into a database which already contains a game succeeded")
+	}
+	s, err := openSQLiteStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := mustJSON(t, got), mustJSON(t, want); g != w {
+		t.Errorf("loaded state differs\ngot:  %s\nwant: %s", g, w)
+	}
+}
+
+func TestSQLiteStateStoreSavesChanges(t *testing.T) {
+	s, err := openSQLiteStateStore(filepath.Join(t.TempDir(), "game.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	gs := testGameState()
+	var shadow stateShadow
+	save := func(step string) {
+		t.Helper()
+		changes, next := diffTestState(t, shadow, gs)
+		if err := s.Save(changes, nil, time.Now()); err != nil {
+			t.Fatalf("%s: %s", step, err)
+		}
+		shadow = next
+		got, err := s.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, w := mustJSON(t, got), mustJSON(t, gs); g != w {
+			t.Errorf("%s: loaded state differs\ngot:  %s\nwant: %s", step, g, w)
+		}
+	}
+	save("initial")
+
+	alice := gs.Players["alice"]
+	space := alice.Board.get(1, 2)
+	space.Photos = space.Photos[1:]
+	space.Photos[0].Caption = "now the only one"
+	space.Hero = space.Photos[0].Key
+	space.Review = nil
+	alice.Devices = append(alice.Devices, "d3")
+	alice.Board.get(0, 0).Completed = true
+	gs.Players["alice"] = alice
+	gs.AuditLog = append(gs.AuditLog, AuditEntry{Action: "delete-photo"})
+	save("changed photos")
+
+	alice.Devices = alice.Devices[:1]
+	alice.Board.get(1, 2).Photos = nil
+	gs.Players["alice"] = alice
+	gs.Players["carol"] = PlayerState{Password: "c", Devices: []string{"d4"}}
+	delete(gs.Players, "bob")
+	save("added and deleted players")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrwonko/photo-bingo/muxval"
+)
+
+// inTempDir runs the test in an empty working directory, where the JSON state files are kept.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// diffTestState diffs a copy of the state, which the returned shadow keeps, so the test may go on modifying the state.
+func diffTestState(t *testing.T, shadow stateShadow, gs GameState) ([]stateChange, stateShadow) {
+	t.Helper()
+	snapshot := muxval.DeepCopy(gs)
+	changes, next, err := shadow.diff(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes, next
+}
+
+func TestJSONFileStoreQuarantinesJournalOfBackup(t *testing.T) {
+	inTempDir(t)
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := &JSONFileStore{}
+	if _, err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	gs := testGameState()
+	var shadow stateShadow
+	save := func(snapshot bool) {
+		t.Helper()
+		changes, next := diffTestState(t, shadow, gs)
+		var data []byte
+		if snapshot {
+			var err error
+			if data, err = json.Marshal(gs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		at = at.Add(time.Hour)
+		if err := s.Save(changes, data, at); err != nil {
+			t.Fatal(err)
+		}
+		shadow = next
+	}
+	save(true)
+	backup := mustJSON(t, gs)
+	delete(gs.Players, "bob")
+	save(true)
+	gs.Players["carol"] = PlayerState{Password: "c"}
+	save(false)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the backup has to be a file of its own, not a link to one of the snapshots
+	prev, err := os.Stat(previousStatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := listSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, snapshot := range snapshots {
+		if info, err := os.Stat(filepath.Join(snapshotDir, snapshot.Name)); err != nil {
+			t.Fatal(err)
+		} else if os.SameFile(prev, info) {
+			t.Errorf("backup %q is the same file as snapshot %q", previousStatePath, snapshot.Name)
+		}
+	}
+
+	if err := os.WriteFile(latestStatePath, []byte(`{"sha256":"00","state":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s = &JSONFileStore{}
+	got, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if g := mustJSON(t, got); g != backup {
+		t.Errorf("loaded state differs from the backup\ngot:  %s\nwant: %s", g, backup)
+	}
+	if info, err := os.Stat(journalPath); err == nil && info.Size() > 0 {
+		t.Errorf("journal %q still contains %d bytes", journalPath, info.Size())
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	if quarantined, err := filepath.Glob(journalPath + ".quarantined-*"); err != nil || len(quarantined) != 1 {
+		t.Errorf("quarantined journals = %q, %v, want one", quarantined, err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BlobStore holds uploaded images and their derivatives, addressed by key.
+// Keys are plain file names without any path separators.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns an error wrapping [fs.ErrNotExist] if there is no blob with this key.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete succeeds if there is no blob with this key.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL granting temporary read access to the blob,
+	// or "" if the store cannot be accessed directly and the blob has to be served via [BlobStore.Get].
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// List returns the keys of all blobs.
+	List(ctx context.Context) ([]string, error)
+}
+
+var blobs BlobStore
+
+func validateBlobKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LocalBlobStore keeps blobs as files in a directory.
+type LocalBlobStore struct {
+	dir string
+}
+
+var _ BlobStore = (*LocalBlobStore)(nil)
+
+func newLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("creating image directory %q: %w", dir, err)
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if err := validateBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0600)
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (s *LocalBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalBlobStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", nil
+}
+
+func (s *LocalBlobStore) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			res = append(res, e.Name())
+		}
+	}
+	return res, nil
+}
+
+// newBlobStoreFromEnv uses S3 if PHOTO_BINGO_S3_BUCKET is set, otherwise the local [imagePath].
+func newBlobStoreFromEnv() (BlobStore, error) {
+	bucket := os.Getenv("PHOTO_BINGO_S3_BUCKET")
+	if bucket == "" {
+		return newLocalBlobStore(imagePath)
+	}
+	return newS3BlobStore(S3Config{
+		Endpoint: os.Getenv("PHOTO_BINGO_S3_ENDPOINT"),
+		Region:   os.Getenv("PHOTO_BINGO_S3_REGION"),
+		Bucket:   bucket,
+		Insecure: os.Getenv("PHOTO_BINGO_S3_INSECURE") == "1",
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config describes an S3-compatible bucket.
+// Credentials are taken from the usual AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+type S3Config struct {
+	Endpoint string // host[:port], defaults to AWS
+	Region   string // defaults to us-east-1
+	Bucket   string
+	Insecure bool // use plain HTTP, e.g. for a local MinIO instance
+}
+
+// S3BlobStore keeps blobs in an S3-compatible bucket.
+type S3BlobStore struct {
+	client *minio.Client
+	bucket string
+}
+
+var _ BlobStore = (*S3BlobStore)(nil)
+
+func newS3BlobStore(cfg S3Config) (*S3BlobStore, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "s3.amazonaws.com"
+	}
+	if cfg.Region == "" {
+		// setting a region avoids a bucket location lookup when presigning
+		cfg.Region = "us-east-1"
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating S3 client for %q: %w", cfg.Endpoint, err)
+	}
+	logf("storing images in S3 bucket %q at %q", cfg.Bucket, cfg.Endpoint)
+	return &S3BlobStore{client: client, bucket: cfg.Bucket}, nil
+}
+
+func isS3NotFound(err error) bool {
+	return minio.ToErrorResponse(err).StatusCode == http.StatusNotFound
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validateBlobKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("uploading %q: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := validateBlobKey(key); err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("downloading %q: %w", key, err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("downloading %q: %w", key, fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("downloading %q: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *S3BlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	if err := validateBlobKey(key); err != nil {
+		return false, err
+	}
+	_, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if isS3NotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("checking %q: %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	if err := validateBlobKey(key); err != nil {
+		return err
+	}
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil && !isS3NotFound(err) {
+		return fmt.Errorf("deleting %q: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := validateBlobKey(key); err != nil {
+		return "", err
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("presigning %q: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3BlobStore) List(ctx context.Context) ([]string, error) {
+	var res []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("listing bucket %q: %w", s.bucket, obj.Err)
+		}
+		res = append(res, obj.Key)
+	}
+	return res, nil
+}
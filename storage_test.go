@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// testBlobStore checks the behavior every [BlobStore] must have.
+// The store may contain other blobs, the test only touches its own.
+func testBlobStore(t *testing.T, s BlobStore) {
+	ctx := context.Background()
+	prefix, err := randStr(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, missing := "test-"+prefix+".jpg", "test-"+prefix+".missing.jpg"
+	data := []byte("not really a JPEG")
+	t.Cleanup(func() { s.Delete(ctx, key) })
+
+	if _, err := s.Get(ctx, missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a missing key: got error %v, want fs.ErrNotExist", err)
+	}
+	if exists, err := s.Exists(ctx, missing); err != nil || exists {
+		t.Errorf("Exists of a missing key = %v, %v, want false", exists, err)
+	}
+	if err := s.Delete(ctx, missing); err != nil {
+		t.Errorf("Delete of a missing key: %s", err)
+	}
+
+	if err := s.Put(ctx, key, data, "image/jpeg"); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+	if got, err := s.Get(ctx, key); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get = %q, %v, want %q", got, err, data)
+	}
+	if exists, err := s.Exists(ctx, key); err != nil || !exists {
+		t.Errorf("Exists = %v, %v, want true", exists, err)
+	}
+	if keys, err := s.List(ctx); err != nil || !slices.Contains(keys, key) {
+		t.Errorf("List = %q, %v, want it to contain %q", keys, err, key)
+	}
+	signed, err := s.SignedURL(ctx, key, time.Minute)
+	if err != nil {
+		t.Errorf("SignedURL: %s", err)
+	} else if signed != "" {
+		resp, err := http.Get(signed)
+		if err != nil {
+			t.Fatalf("fetching signed URL: %s", err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK || !bytes.Equal(got, data) {
+			t.Errorf("fetching signed URL = %s %q, %v, want %q", resp.Status, got, err, data)
+		}
+	}
+
+	replaced := []byte("replaced")
+	if err := s.Put(ctx, key, replaced, "image/jpeg"); err != nil {
+		t.Fatalf("Put replacing a blob: %s", err)
+	}
+	if got, err := s.Get(ctx, key); err != nil || !bytes.Equal(got, replaced) {
+		t.Errorf("Get after replacing = %q, %v, want %q", got, err, replaced)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get after Delete: got error %v, want fs.ErrNotExist", err)
+	}
+	if exists, err := s.Exists(ctx, key); err != nil || exists {
+		t.Errorf("Exists after Delete = %v, %v, want false", exists, err)
+	}
+	if keys, err := s.List(ctx); err != nil || slices.Contains(keys, key) {
+		t.Errorf("List after Delete = %q, %v, want it not to contain %q", keys, err, key)
+	}
+
+	for _, invalid := range []string{"", "..", "a/b", `a\b`} {
+		if err := s.Put(ctx, invalid, data, "image/jpeg"); err == nil {
+			t.Errorf("Put with invalid key %q succeeded", invalid)
+		}
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	s, err := newLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, s)
+}
+
+// TestS3BlobStore runs against a real bucket, e.g. of a local MinIO:
+//
+//	PHOTO_BINGO_S3_ENDPOINT=localhost:9000 PHOTO_BINGO_S3_INSECURE=1 AWS_ACCESS_KEY_ID=... AWS_SECRET_ACCESS_KEY=... go test -run S3
+func TestS3BlobStore(t *testing.T) {
+	endpoint := os.Getenv("PHOTO_BINGO_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("PHOTO_BINGO_S3_ENDPOINT not set")
+	}
+	s, err := newS3BlobStore(S3Config{
+		Endpoint: endpoint,
+		Region:   os.Getenv("PHOTO_BINGO_S3_REGION"),
+		Bucket:   cmp.Or(os.Getenv("PHOTO_BINGO_S3_BUCKET"), "photo-bingo-test"),
+		Insecure: os.Getenv("PHOTO_BINGO_S3_INSECURE") == "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testBlobStore(t, s)
+}
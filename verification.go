@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// VerificationMode determines who confirms the photos of completed spaces before they count towards the score,
+// if the [CompletionPolicy] is [CompleteVerified].
+type VerificationMode string
+
+const (
+	VerifyNone      VerificationMode = ""
+	VerifyModerator VerificationMode = "moderator" // a moderator has to approve
+	VerifyPeers     VerificationMode = "peers"     // [GameSettings.RequiredApprovals] other players (or a moderator) have to approve
+)
+
+func parseVerificationMode(s string) (VerificationMode, error) {
+	switch m := VerificationMode(s); m {
+	case VerifyNone, VerifyModerator, VerifyPeers:
+		return m, nil
+	case "none":
+		return VerifyNone, nil
+	default:
+		return "", fmt.Errorf("invalid verification mode %q, must be one of none, moderator, peers", s)
+	}
+}
+
+// CompletionPolicy determines what players have to do to complete a space.
+type CompletionPolicy string
+
+const (
+	CompleteHonor    CompletionPolicy = ""         // players may complete spaces without uploading anything
+	CompletePhoto    CompletionPolicy = "photo"    // completing a space requires a photo
+	CompleteVerified CompletionPolicy = "verified" // like [CompletePhoto], and the photo has to be verified by [GameSettings.Verification]
+)
+
+func parseCompletionPolicy(s string) (CompletionPolicy, error) {
+	switch p := CompletionPolicy(s); p {
+	case CompleteHonor, CompletePhoto, CompleteVerified:
+		return p, nil
+	case "honor":
+		return CompleteHonor, nil
+	default:
+		return "", fmt.Errorf("invalid completion policy %q, must be one of honor, photo, verified", s)
+	}
+}
+
+// photoRequired reports whether spaces can only be completed by uploading a photo.
+func (settings GameSettings) photoRequired() bool {
+	return settings.Completion != CompleteHonor
+}
+
+// verifiers returns who has to verify completed spaces, which is nobody unless the completion policy requires it.
+func (settings GameSettings) verifiers() VerificationMode {
+	if settings.Completion != CompleteVerified {
+		return VerifyNone
+	}
+	return settings.Verification
+}
+
+type ReviewStatus string
+
+const (
+	ReviewPending  ReviewStatus = "pending"
+	ReviewApproved ReviewStatus = "approved"
+	ReviewRejected ReviewStatus = "rejected"
+)
+
+// Review records whether the submitted photo of a space matches its goal.
+type Review struct {
+	Photo      string       `json:"photo"` // the [BingoSpace.Hero] which was reviewed
+	Status     ReviewStatus `json:"status"`
+	Approvals  []PlayerName `json:"approvals,omitempty"`
+	Rejections []PlayerName `json:"rejections,omitempty"`
+	Reason     string       `json:"reason,omitempty"` // given by the latest rejection
+}
+
+// reviewStatus returns the status of the current submission, which is pending if a different photo was reviewed.
+func (space *BingoSpace) reviewStatus() ReviewStatus {
+	if space.GoalIdx == freeGoalIdx {
+		return ReviewApproved
+	}
+	if space.Review == nil || space.Hero == "" || space.Review.Photo != space.Hero {
+		return ReviewPending
+	}
+	return space.Review.Status
+}
+
+// counts reports whether the space counts towards the score.
+func (space *BingoSpace) counts(settings GameSettings) bool {
+	switch {
+	case !space.Completed:
+		return false
+	case space.GoalIdx == freeGoalIdx:
+		return true
+	case settings.photoRequired() && space.Hero == "":
+		// completed before the policy was changed
+		return false
+	}
+	return settings.verifiers() == VerifyNone || space.reviewStatus() == ReviewApproved
+}
+
+func (gs *GameState) requiredApprovals() int {
+	return max(1, gs.Settings.RequiredApprovals)
+}
+
+// review records a reviewer's decision on the submission for a space.
+// The key must match the current submission, in case it was changed in the meantime.
+func (gs *GameState) review(reviewer PlayerName, player PlayerName, x, y int, key string, approve bool, reason string, now time.Time) error {
+	mode := gs.Settings.verifiers()
+	isModerator := gs.Players[reviewer].Moderator
+	switch {
+	case mode == VerifyNone:
+		return errors.New("spaces don't need to be verified in this game")
+	case mode == VerifyModerator && !isModerator:
+		return errors.New("only moderators may verify spaces in this game")
+	case reviewer == player:
+		return errors.New("you cannot verify your own spaces")
+	case !approve && reason == "":
+		return errors.New("please give a reason for the rejection")
+	case len(reason) > maxCommentLength:
+		return fmt.Errorf("reason too long, limit %d characters", maxCommentLength)
+	}
+	ps, ok := gs.Players[player]
+	if !ok {
+		return fmt.Errorf("unknown player %q", player)
+	}
+	space := ps.Board.get(x, y)
+	if space.Hero == "" || space.Hero != key {
+		return errors.New("the submission has changed, please review again")
+	}
+	if space.Review == nil || space.Review.Photo != key {
+		space.Review = &Review{Photo: key, Status: ReviewPending}
+	}
+	r := space.Review
+	before := r.Status
+	r.Approvals = slices.DeleteFunc(r.Approvals, func(p PlayerName) bool { return p == reviewer })
+	r.Rejections = slices.DeleteFunc(r.Rejections, func(p PlayerName) bool { return p == reviewer })
+	if approve {
+		r.Approvals = append(r.Approvals, reviewer)
+	} else {
+		r.Rejections = append(r.Rejections, reviewer)
+		r.Reason = reason
+	}
+	switch {
+	case isModerator && approve:
+		r.Status = ReviewApproved
+	case isModerator:
+		r.Status = ReviewRejected
+	case len(r.Approvals) >= gs.requiredApprovals():
+		r.Status = ReviewApproved
+	case len(r.Rejections) >= gs.requiredApprovals():
+		r.Status = ReviewRejected
+	default:
+		r.Status = ReviewPending
+	}
+	gs.Players[player] = ps
+	action := "approve"
+	if !approve {
+		action = "reject"
+	}
+	gs.audit(AuditEntry{
+		At:     now,
+		Actor:  reviewer,
+		Action: action,
+		Player: player,
+		Target: spaceTarget(x, y, space),
+		Before: string(before),
+		After:  string(r.Status),
+		Detail: reason,
+	})
+	return nil
+}
+
+type ReviewData struct {
+	BaseURL string
+	Pending []PendingReview
+}
+
+// PendingReview is a submission awaiting verification.
+type PendingReview struct {
+	Player PlayerName
+	X, Y   int
+	Goal   Goal
+	Photo  DisplayPhoto
+	Review *Review // nil if nobody reviewed it yet
+}
+
+// pendingReviews returns the submissions the reviewer may verify and hasn't yet.
+func (gs *GameState) pendingReviews(reviewer PlayerName) []PendingReview {
+	mode := gs.Settings.verifiers()
+	isModerator := gs.Players[reviewer].Moderator
+	if mode == VerifyNone || (mode == VerifyModerator && !isModerator) {
+		return nil
+	}
+	var res []PendingReview
+	for name, ps := range gs.Players {
+		if name == reviewer {
+			continue
+		}
+		for x := range 5 {
+			for y := range 5 {
+				space := ps.Board.get(x, y)
+				if !space.Completed || space.Hero == "" || space.reviewStatus() != ReviewPending {
+					continue
+				}
+				if space.photo(space.Hero).Hidden && !isModerator {
+					continue
+				}
+				var review *Review
+				if space.Review != nil && space.Review.Photo == space.Hero {
+					review = space.Review
+					if slices.Contains(review.Approvals, reviewer) || slices.Contains(review.Rejections, reviewer) {
+						continue
+					}
+				}
+				res = append(res, PendingReview{
+					Player: name,
+					X:      x,
+					Y:      y,
+					Goal:   space.goal(),
+					Photo:  space.photo(space.Hero).display(),
+					Review: review,
+				})
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b PendingReview) int {
+		return a.Photo.Uploaded.Compare(b.Photo.Uploaded)
+	})
+	return res
+}
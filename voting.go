@@ -0,0 +1,157 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Vote is a player's choice of the best photo for a goal.
+type Vote struct {
+	Photo  string    `json:"photo"`  // [Photo.Key]
+	Device string    `json:"device"` // see [deviceID]
+	At     time.Time `json:"at"`
+}
+
+// VoteResults are the tallied votes, see [GameState.voteResults].
+type VoteResults struct {
+	Counts      map[string]int // valid votes per photo key
+	GoalWinners map[int][]string
+	Overall     []PlayerName // the players with the most votes in total
+}
+
+// castVote records the voter's choice for the goal, replacing any previous one.
+func (gs *GameState) castVote(voter PlayerName, device string, goalIdx int, key string, now time.Time) error {
+	if gs.Settings.Phase != PhaseVoting {
+		return errors.New("voting is not open")
+	}
+	loc, ok := gs.locatePhoto(key)
+	if !ok || !loc.IsHero {
+		return fmt.Errorf("no submitted photo %q", key)
+	}
+	if loc.Photo.Hidden {
+		return fmt.Errorf("photo %q was hidden by a moderator", key)
+	}
+	if loc.GoalIdx != goalIdx {
+		return fmt.Errorf("photo %q was not submitted for this goal", key)
+	}
+	if loc.Player == voter {
+		return errors.New("you cannot vote for your own photo")
+	}
+	ps := gs.Players[voter]
+	if !slices.Contains(ps.Devices, device) {
+		ps.Devices = append(ps.Devices, device)
+		gs.Players[voter] = ps
+	}
+	if gs.Votes == nil {
+		gs.Votes = map[PlayerName]map[int]Vote{}
+	}
+	if gs.Votes[voter] == nil {
+		gs.Votes[voter] = map[int]Vote{}
+	}
+	gs.audit(AuditEntry{
+		At:     now,
+		Actor:  voter,
+		Action: "vote",
+		Player: loc.Player,
+		Target: loc.Goal.Name,
+		Before: gs.Votes[voter][goalIdx].Photo,
+		After:  key,
+	})
+	gs.Votes[voter][goalIdx] = Vote{Photo: key, Device: device, At: now}
+	return nil
+}
+
+// voteResults tallies the votes. Photos hidden by a moderator get none.
+// To mitigate people voting with several accounts, only the first vote per goal from each device counts,
+// and votes from devices the photo's owner has used don't count at all.
+func (gs *GameState) voteResults() VoteResults {
+	type goalVote struct {
+		goalIdx int
+		Vote
+	}
+	var votes []goalVote
+	for _, byGoal := range gs.Votes {
+		for goalIdx, vote := range byGoal {
+			votes = append(votes, goalVote{goalIdx, vote})
+		}
+	}
+	slices.SortFunc(votes, func(a, b goalVote) int {
+		return a.At.Compare(b.At)
+	})
+
+	res := VoteResults{
+		Counts:      map[string]int{},
+		GoalWinners: map[int][]string{},
+	}
+	type deviceGoal struct {
+		device  string
+		goalIdx int
+	}
+	counted := map[deviceGoal]bool{}
+	totals := map[PlayerName]int{}
+	for _, v := range votes {
+		loc, ok := gs.locatePhoto(v.Photo)
+		if !ok || !loc.IsHero || loc.Photo.Hidden {
+			// no longer submitted, or hidden after the vote
+			continue
+		}
+		if slices.Contains(gs.Players[loc.Player].Devices, v.Device) {
+			continue
+		}
+		if counted[deviceGoal{v.Device, v.goalIdx}] {
+			continue
+		}
+		counted[deviceGoal{v.Device, v.goalIdx}] = true
+		res.Counts[v.Photo]++
+		totals[loc.Player]++
+	}
+
+	goalBest := map[int]int{}
+	owners := map[string]PlayerName{}
+	for key, n := range res.Counts {
+		loc, _ := gs.locatePhoto(key)
+		goalIdx := loc.GoalIdx
+		owners[key] = loc.Player
+		switch {
+		case n > goalBest[goalIdx]:
+			goalBest[goalIdx] = n
+			res.GoalWinners[goalIdx] = []string{key}
+		case n == goalBest[goalIdx]:
+			res.GoalWinners[goalIdx] = append(res.GoalWinners[goalIdx], key)
+		}
+	}
+	// ties are ordered by owner, so pages don't change between renders
+	for _, keys := range res.GoalWinners {
+		slices.SortFunc(keys, func(a, b string) int {
+			return cmp.Or(cmp.Compare(owners[a], owners[b]), cmp.Compare(a, b))
+		})
+	}
+	best := 0
+	for name, n := range totals {
+		switch {
+		case n > best:
+			best = n
+			res.Overall = []PlayerName{name}
+		case n == best:
+			res.Overall = append(res.Overall, name)
+		}
+	}
+	slices.Sort(res.Overall)
+	return res
+}
+
+// goalsWon returns how many goals the player's photos won.
+func (results *VoteResults) goalsWon(gs *GameState, player PlayerName) int {
+	res := 0
+	for _, keys := range results.GoalWinners {
+		for _, key := range keys {
+			if owner, _ := gs.imageOwner(key); owner == player {
+				res++
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVoteResultsOrdersTiesByOwner(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	gs := GameState{Players: map[PlayerName]PlayerState{}, Votes: map[PlayerName]map[int]Vote{}}
+	owners := []PlayerName{"dave", "bob", "erin", "alice", "carol"}
+	for i, owner := range owners {
+		var ps PlayerState
+		ps.Devices = []string{"owner-" + string(owner)}
+		space := ps.Board.get(0, 0)
+		key := string(owner) + ".jpg"
+		space.GoalIdx, space.Completed, space.Hero = 3, true, key
+		space.Photos = []Photo{{Key: key}}
+		gs.Players[owner] = ps
+		// one vote for each photo, so they all tie
+		gs.Votes["voter-"+owner] = map[int]Vote{3: {Photo: key, Device: "voter-" + string(owner), At: at.Add(time.Duration(i))}}
+	}
+	want := []string{"alice.jpg", "bob.jpg", "carol.jpg", "dave.jpg", "erin.jpg"}
+	for range 20 {
+		if got := gs.voteResults().GoalWinners[3]; !slices.Equal(got, want) {
+			t.Fatalf("winners = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestHiddenPhotosGetNoVotes(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	gs := GameState{Players: map[PlayerName]PlayerState{}, Settings: GameSettings{Phase: PhaseVoting}}
+	for _, owner := range []PlayerName{"alice", "bob"} {
+		var ps PlayerState
+		ps.Devices = []string{"owner-" + string(owner)}
+		space := ps.Board.get(0, 0)
+		key := string(owner) + ".jpg"
+		space.GoalIdx, space.Completed, space.Hero = 3, true, key
+		space.Photos = []Photo{{Key: key}}
+		gs.Players[owner] = ps
+	}
+	for i, voter := range []PlayerName{"carol", "dave"} {
+		if err := gs.castVote(voter, "voter-"+string(voter), 3, "alice.jpg", at.Add(time.Duration(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gs.castVote("erin", "voter-erin", 3, "bob.jpg", at); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := gs.Players["alice"]
+	alice.Board.get(0, 0).Photos[0].Hidden = true
+	gs.Players["alice"] = alice
+	if err := gs.castVote("frank", "voter-frank", 3, "alice.jpg", at); err == nil {
+		t.Error("voting for a hidden photo succeeded")
+	}
+	results := gs.voteResults()
+	if n := results.Counts["alice.jpg"]; n != 0 {
+		t.Errorf("hidden photo got %d votes", n)
+	}
+	if got := results.GoalWinners[3]; !slices.Equal(got, []string{"bob.jpg"}) {
+		t.Errorf("winners = %q, want only bob.jpg", got)
+	}
+	if !slices.Equal(results.Overall, []PlayerName{"bob"}) {
+		t.Errorf("overall winners = %q, want only bob", results.Overall)
+	}
+	if n := results.goalsWon(&gs, "alice"); n != 0 {
+		t.Errorf("alice won %d goals with a hidden photo", n)
+	}
+}